@@ -0,0 +1,148 @@
+package main
+
+import "fmt"
+import "sort"
+
+// Look for reasons the puzzle on the paper can't be solved, which can be
+// found without searching. Returns a human readable description of each, or
+// nothing if the puzzle may well be solvable.
+//
+// The checks are:
+//   - every label must appear exactly twice
+//   - every source must have a neighbour it can connect to
+//   - every empty square must have two neighbours to connect to
+//   - every bridge must have four neighbours to connect to
+//   - a straight cut through the paper can't be crossed by more pairs than
+//     it has squares along it
+//   - colouring the paper like a checkerboard, a flow between two squares of
+//     the same colour covers one more square of that colour than the other.
+//     Hence the difference between black and white squares on the paper,
+//     must equal the number of black-black pairs minus white-white pairs.
+//     Bridges count twice, as two flows cover them.
+//
+// On wrapped papers, flows can go around the cuts parallel to the joined
+// edges, and the parity only holds if the joined edges are an even number of
+// squares apart.
+func Analyze(paper *Paper) []string {
+	w, h := paper.Width, paper.Height
+	problems := make([]string, 0)
+	at := func(pos int) string {
+		return fmt.Sprintf("(%d,%d)", pos%w-1, pos/w-1)
+	}
+
+	// Label counts
+	sources := make(map[rune][]int)
+	labels := make([]rune, 0)
+	for pos, val := range paper.Table {
+		if val != GRASS && val != EMPTY && val != BRIDGE {
+			if _, found := sources[val]; !found {
+				labels = append(labels, val)
+			}
+			sources[val] = append(sources[val], pos)
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i] < labels[j] })
+	for _, label := range labels {
+		if n := len(sources[label]); n == 1 {
+			problems = append(problems, fmt.Sprintf("Label %c appears once, not twice", label))
+		} else if n != 2 {
+			problems = append(problems, fmt.Sprintf("Label %c appears %d times, not twice", label, n))
+		}
+	}
+
+	// Walled in squares
+	for pos, val := range paper.Table {
+		if val == GRASS {
+			continue
+		}
+		free := 0
+		for _, dir := range DIRS {
+			next := paper.Table[paper.neighbour(pos, dir)]
+			if next == EMPTY || next == BRIDGE || (val == EMPTY || val == BRIDGE) && next != GRASS || next == val {
+				free++
+			}
+		}
+		if val == BRIDGE && free < 4 {
+			problems = append(problems, fmt.Sprintf("Bridge at %s has fewer than four neighbours to connect", at(pos)))
+		}
+		if val != EMPTY && val != BRIDGE && free == 0 {
+			problems = append(problems, fmt.Sprintf("Source %c at %s is walled in", val, at(pos)))
+		}
+		if val == EMPTY && free < 2 {
+			problems = append(problems, fmt.Sprintf("Square at %s has fewer than two neighbours to connect", at(pos)))
+		}
+	}
+
+	// Cuts between two columns and between two rows. The pairs with a source
+	// on each side must cross the cut, each in a square of their own.
+	pairs := make([][]int, 0)
+	for _, label := range labels {
+		if len(sources[label]) == 2 {
+			pairs = append(pairs, sources[label])
+		}
+	}
+	for x := 1; x < w-2 && paper.Wrap&E == 0; x++ {
+		crossing, room := 0, 0
+		for _, p := range pairs {
+			if (p[0]%w <= x) != (p[1]%w <= x) {
+				crossing++
+			}
+		}
+		for y := 1; y < h-1; y++ {
+			if paper.Table[y*w+x] != GRASS && paper.Table[y*w+x+1] != GRASS {
+				room++
+			}
+		}
+		if crossing > room {
+			problems = append(problems, fmt.Sprintf("%d pairs must cross between column %d and %d, which only has room for %d", crossing, x-1, x, room))
+		}
+	}
+	for y := 1; y < h-2 && paper.Wrap&S == 0; y++ {
+		crossing, room := 0, 0
+		for _, p := range pairs {
+			if (p[0]/w <= y) != (p[1]/w <= y) {
+				crossing++
+			}
+		}
+		for x := 1; x < w-1; x++ {
+			if paper.Table[y*w+x] != GRASS && paper.Table[(y+1)*w+x] != GRASS {
+				room++
+			}
+		}
+		if crossing > room {
+			problems = append(problems, fmt.Sprintf("%d pairs must cross between row %d and %d, which only has room for %d", crossing, y-1, y, room))
+		}
+	}
+
+	// Checkerboard parity, only meaningful if the labels are fine
+	even := (paper.Wrap&E == 0 || w%2 == 0) && (paper.Wrap&S == 0 || h%2 == 0)
+	if len(pairs) == len(labels) && even {
+		black := func(pos int) bool { return (pos%w+pos/w)%2 == 0 }
+		diff, pairDiff := 0, 0
+		for pos, val := range paper.Table {
+			if val == GRASS {
+				continue
+			}
+			n := 1
+			if val == BRIDGE {
+				n = 2
+			}
+			if black(pos) {
+				diff += n
+			} else {
+				diff -= n
+			}
+		}
+		for _, p := range pairs {
+			if b1, b2 := black(p[0]), black(p[1]); b1 && b2 {
+				pairDiff++
+			} else if !b1 && !b2 {
+				pairDiff--
+			}
+		}
+		if diff != pairDiff {
+			problems = append(problems, fmt.Sprintf("The paper has %d more black than white squares, but the pairs can only cover %d more", diff, pairDiff))
+		}
+	}
+	return problems
+}
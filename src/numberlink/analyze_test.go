@@ -0,0 +1,55 @@
+package main
+
+import "strings"
+import "testing"
+
+var analyzetests = []struct {
+	lines    []string
+	problems []string
+}{
+	{[]string{
+		"a.b",
+		".c.",
+		"b.a",
+	}, []string{"Label c appears once, not twice"}},
+	{[]string{
+		"ab.a",
+		"cd.b",
+		".dc.",
+	}, []string{"Source a at (0,0) is walled in"}},
+	{[]string{
+		"aa..",
+	}, []string{"Square at (3,0) has fewer than two neighbours"}},
+	{[]string{
+		"abc.cb",
+		"....a.",
+	}, []string{"3 pairs must cross between column 2 and 3", "3 pairs must cross between column 3 and 4"}},
+	{[]string{
+		"a.",
+		".a",
+	}, []string{"The paper has 0 more black than white squares, but the pairs can only cover 1 more"}},
+	// Solvable puzzles must pass
+	{[]string{
+		"C...B",
+		"A.BA.",
+		"...C.",
+		".....",
+	}, nil},
+	{checkpointtest, nil},
+}
+
+func TestAnalyze(t *testing.T) {
+	for _, test := range analyzetests {
+		p, _ := Parse(len(test.lines[0]), len(test.lines), test.lines)
+		problems := Analyze(p)
+		if len(problems) != len(test.problems) {
+			t.Errorf("Expected %d problems with %v, got %v", len(test.problems), test.lines, problems)
+			continue
+		}
+		for i, problem := range problems {
+			if !strings.HasPrefix(problem, test.problems[i]) {
+				t.Errorf("Expected '%s...', got '%s'", test.problems[i], problem)
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import "bytes"
+import "fmt"
+import "io"
+import "time"
+
+const (
+	CLEAR      = "\x1b[2J"
+	HOME       = "\x1b[H"
+	REVERSE    = "\x1b[7m"
+	CLEAR_LINE = "\x1b[K"
+)
+
+// Redraws the paper in place as the search progresses, with the diagonal
+// being filled highlighted
+type Animator struct {
+	out io.Writer
+	// Time between frames
+	delay time.Duration
+	// Only every skip'th call of the search is drawn
+	skip  int
+	calls int
+	last  time.Time
+	buf   bytes.Buffer
+}
+
+func NewAnimator(out io.Writer, fps float64, skip int) *Animator {
+	if skip < 1 {
+		skip = 1
+	}
+	delay := time.Duration(0)
+	if fps > 0 {
+		delay = time.Duration(float64(time.Second) / fps)
+	}
+	return &Animator{out: out, delay: delay, skip: skip}
+}
+
+// Start animating the search of the puzzle loaded into paper
+func (anim *Animator) Start(paper *Paper) {
+	paper.animate = anim
+	anim.calls = 0
+	fmt.Fprint(anim.out, CLEAR)
+}
+
+// Called by the search each time it gets to pos
+func (anim *Animator) frame(paper *Paper, pos int) {
+	anim.calls++
+	if anim.calls%anim.skip != 0 {
+		return
+	}
+	if wait := anim.delay - time.Since(anim.last); wait > 0 {
+		time.Sleep(wait)
+	}
+	anim.last = time.Now()
+	anim.draw(paper, pos)
+}
+
+// Draw the paper like PrintTubes, highlighting the squares on the diagonal
+// of pos. Each frame is written in one go to avoid flicker.
+func (anim *Animator) draw(paper *Paper, pos int) {
+	w := paper.Width
+	diagonal := -1
+	if pos != 0 {
+		diagonal = pos%w + pos/w
+	}
+	buf := &anim.buf
+	buf.Reset()
+	buf.WriteString(HOME)
+	for y := 1; y < paper.Height-1; y++ {
+		for x := 1; x < w-1; x++ {
+			p := y*w + x
+			c := paper.Table[p]
+			if c == EMPTY {
+				c = TUBE[paper.Con(p)]
+			}
+			if x+y == diagonal {
+				fmt.Fprintf(buf, "%s%c%s", REVERSE, c, RESET)
+			} else {
+				buf.WriteRune(c)
+			}
+		}
+		buf.WriteByte('\n')
+	}
+	if diagonal == -1 {
+		fmt.Fprintf(buf, "Calls: %d  Done%s\n", Calls, CLEAR_LINE)
+	} else {
+		fmt.Fprintf(buf, "Calls: %d  Diagonal: %d of %d%s\n", Calls, diagonal-1, w+paper.Height-5, CLEAR_LINE)
+	}
+	anim.out.Write(buf.Bytes())
+}
+
+// Draw the final state of the paper, once the search is over
+func (anim *Animator) Finish(paper *Paper) {
+	anim.draw(paper, 0)
+}
@@ -0,0 +1,32 @@
+package main
+
+import "bytes"
+import "strings"
+import "testing"
+
+func TestAnimator(t *testing.T) {
+	var buf bytes.Buffer
+	anim := NewAnimator(&buf, 0, 3)
+	p, _ := Parse(5, 4, []string{
+		"C...B",
+		"A.BA.",
+		"...C.",
+		".....",
+	})
+	anim.Start(p)
+	Calls = 0
+	if !Solve(p) {
+		t.Fatal("Expected the puzzle to be solvable")
+	}
+	anim.Finish(p)
+
+	// One frame for every third call, and the final one
+	frames := strings.Count(buf.String(), HOME)
+	if expected := Calls/3 + 1; frames != expected {
+		t.Errorf("Drew %d frames, expected %d", frames, expected)
+	}
+	last := buf.String()[strings.LastIndex(buf.String(), HOME):]
+	if !strings.Contains(last, "C┐┌─B\n") || strings.Contains(last, REVERSE) {
+		t.Errorf("Unexpected final frame: %q", last)
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import "math/bits"
+
+// A specialised solver for papers of at most 64 squares, such as the ones we
+// go through by the million when enumerating every small puzzle. It runs the
+// same diagonal sweep as Solve, but without the grass border, so that static
+// information like sources, pivots and the edges of the paper fits in uint64
+// bitboards. Square y*width+x is stored in bit y*width+x.
+//
+// A BitSolver can be reused for any number of puzzles of the same size, and
+// doesn't allocate while solving.
+
+const MaxBitSquares = 64
+
+type BitSolver struct {
+	width, height int
+
+	// Squares having a neighbour in each (possibly diagonal) direction
+	has  [16]uint64
+	vctr [16]int
+	// Masks to stop shifts from wrapping around the sides of the paper
+	notWest, notEast uint64
+	// Diagonal order of the squares, -1 marks the end
+	next [MaxBitSquares]int
+
+	source uint64
+	canSE  uint64
+	canSW  uint64
+	// The pair of each source, and -1 for empty squares
+	label [MaxBitSquares]int
+	// The first source of each pair, used for validation
+	first [MaxBitSquares / 2]int
+	pairs int
+
+	Con [MaxBitSquares]int
+	end [MaxBitSquares]int
+}
+
+func NewBitSolver(width, height int) *BitSolver {
+	if width*height > MaxBitSquares {
+		panic("BitSolver: paper too large for a bitboard")
+	}
+	bs := &BitSolver{width: width, height: height}
+
+	board := ^uint64(0) >> uint(MaxBitSquares-width*height)
+	bs.notWest, bs.notEast = board, board
+	for y := 0; y < height; y++ {
+		bs.notWest &^= 1 << uint(y*width)
+		bs.notEast &^= 1 << uint(y*width+width-1)
+	}
+	bs.has[N] = board &^ (1<<uint(width) - 1)
+	bs.has[E] = bs.notEast
+	bs.has[S] = board >> uint(width)
+	bs.has[W] = bs.notWest
+	for dir := 0; dir < 16; dir++ {
+		if DIAG[dir] {
+			bs.has[dir] = bs.has[dir&(N|S)] & bs.has[dir&(E|W)]
+		}
+		if dir&N != 0 {
+			bs.vctr[dir] -= width
+		}
+		if dir&E != 0 {
+			bs.vctr[dir] += 1
+		}
+		if dir&S != 0 {
+			bs.vctr[dir] += width
+		}
+		if dir&W != 0 {
+			bs.vctr[dir] -= 1
+		}
+	}
+
+	// Diagonal 'next' table, like in Paper.initTables
+	last := -1
+	for start := 0; start < width+height-1; start++ {
+		x, y := start, 0
+		if start >= width {
+			x, y = width-1, start-width+1
+		}
+		for ; x >= 0 && y < height; x, y = x-1, y+1 {
+			if last != -1 {
+				bs.next[last] = y*width + x
+			}
+			last = y*width + x
+		}
+	}
+	bs.next[last] = -1
+
+	return bs
+}
+
+// Solve the puzzle with the given pairs of sources, where sources are
+// numbered y*width+x. The result is left in bs.Con.
+func (bs *BitSolver) Solve(sources [][2]int) bool {
+	size := bs.width * bs.height
+	bs.source, bs.canSE, bs.canSW = 0, 0, 0
+	for pos := 0; pos < size; pos++ {
+		bs.label[pos] = -1
+		bs.Con[pos] = 0
+		bs.end[pos] = pos
+	}
+	for i, pair := range sources {
+		for _, pos := range pair {
+			if bs.label[pos] != -1 {
+				return false
+			}
+			bs.label[pos] = i
+			bs.source |= 1 << uint(pos)
+		}
+		bs.first[i] = pair[0]
+	}
+	bs.pairs = len(sources)
+
+	// Pivot tables
+	for s := bs.source; s != 0; s &= s - 1 {
+		pos := bits.TrailingZeros64(s)
+		for p := pos; bs.has[N|W]&(1<<uint(p)) != 0; {
+			p += bs.vctr[N|W]
+			if bs.source&(1<<uint(p)) != 0 {
+				break
+			}
+			bs.canSE |= 1 << uint(p)
+		}
+		for p := pos; bs.has[N|E]&(1<<uint(p)) != 0; {
+			p += bs.vctr[N|E]
+			if bs.source&(1<<uint(p)) != 0 {
+				break
+			}
+			bs.canSW |= 1 << uint(p)
+		}
+	}
+
+	return bs.chooseConnection(0)
+}
+
+// The connections of the square in direction dir from pos, or 0 if it is
+// outside the paper
+func (bs *BitSolver) conAt(pos, dir int) int {
+	if bs.has[dir]&(1<<uint(pos)) == 0 {
+		return 0
+	}
+	return bs.Con[pos+bs.vctr[dir]]
+}
+
+// Whether the square in direction dir from pos is a source
+func (bs *BitSolver) sourceAt(pos, dir int) bool {
+	return bs.has[dir]&(1<<uint(pos)) != 0 && bs.source&(1<<uint(pos+bs.vctr[dir])) != 0
+}
+
+// See chooseConnection in paper.go for an explanation of the rules
+func (bs *BitSolver) chooseConnection(pos int) bool {
+	Calls++
+
+	// Final
+	if pos == -1 {
+		return bs.validate()
+	}
+
+	bit := uint64(1) << uint(pos)
+	if bs.source&bit != 0 {
+		switch bs.Con[pos] {
+		case 0:
+			if bs.conAt(pos, N|E) != S|W {
+				if bs.tryConnection(pos, E) {
+					return true
+				}
+			}
+			if bs.checkImplicitSE(pos) {
+				if bs.tryConnection(pos, S) {
+					return true
+				}
+			}
+		case N, W:
+			return bs.chooseConnection(bs.next[pos])
+		}
+	} else {
+		switch bs.Con[pos] {
+		case 0:
+			if bs.canSE&bit != 0 {
+				return bs.tryConnection(pos, E|S)
+			}
+		case W:
+			if bs.canSW&bit != 0 && bs.checkSWLane(pos) && bs.checkImplicitSE(pos) {
+				if bs.tryConnection(pos, S) {
+					return true
+				}
+			}
+			if bs.conAt(pos, N|E) != S|W && bs.conAt(pos, N|W) != S|E {
+				return bs.tryConnection(pos, E)
+			}
+		case N | W:
+			if bs.conAt(pos, N|W) == N|W || bs.sourceAt(pos, N|W) {
+				return bs.chooseConnection(bs.next[pos])
+			}
+		case N:
+			ne := bs.conAt(pos, N|E)
+			if ne == N|E || bs.sourceAt(pos, N|E) && ne&(N|E) != 0 {
+				if bs.tryConnection(pos, E) {
+					return true
+				}
+			}
+			if ne != S|W && bs.conAt(pos, N|W) != S|E && bs.checkImplicitSE(pos) {
+				return bs.tryConnection(pos, S)
+			}
+		}
+	}
+	return false
+}
+
+func (bs *BitSolver) checkSWLane(pos int) bool {
+	for ; bs.source&(1<<uint(pos)) == 0; pos += bs.vctr[S|W] {
+		if bs.Con[pos] != W {
+			return false
+		}
+	}
+	return true
+}
+
+func (bs *BitSolver) checkImplicitSE(pos int) bool {
+	if bs.has[E]&(1<<uint(pos)) == 0 {
+		return true
+	}
+	bit := uint64(1) << uint(pos+1)
+	return bs.Con[pos+1] != 0 || bs.canSE&bit != 0 || bs.source&bit != 0
+}
+
+func (bs *BitSolver) tryConnection(pos1 int, dirs int) bool {
+	dir := dirs & -dirs
+	// Cannot connect out of the paper
+	if bs.has[dir]&(1<<uint(pos1)) == 0 {
+		return false
+	}
+	pos2 := pos1 + bs.vctr[dir]
+	end1, end2 := bs.end[pos1], bs.end[pos2]
+
+	// Check different sources aren't connected
+	if bs.label[end1] != -1 && bs.label[end2] != -1 && bs.label[end1] != bs.label[end2] {
+		return false
+	}
+	// No loops
+	if end1 == pos2 && end2 == pos1 {
+		return false
+	}
+	// No tight corners
+	if bs.Con[pos1] != 0 {
+		dir2 := bs.Con[pos1+bs.vctr[bs.Con[pos1]]]
+		dir3 := bs.Con[pos1] | dir
+		if DIAG[dir2] && DIAG[dir3] && dir2&dir3 != 0 {
+			return false
+		}
+	}
+
+	old1, old2 := bs.Con[pos1], bs.Con[pos2]
+	bs.Con[pos1] |= dir
+	bs.Con[pos2] |= MIR[dir]
+	old3, old4 := bs.end[end1], bs.end[end2]
+	bs.end[end1] = end2
+	bs.end[end2] = end1
+
+	dir2 := dirs &^ dir
+	res := false
+	if dir2 == 0 {
+		res = bs.chooseConnection(bs.next[pos1])
+	} else {
+		res = bs.tryConnection(pos1, dir2)
+	}
+
+	if !res {
+		bs.Con[pos1] = old1
+		bs.Con[pos2] = old2
+		bs.end[end1] = old3
+		bs.end[end2] = old4
+	}
+	return res
+}
+
+// Check that no flow touches itself. A flow of n squares is a simple,
+// untouching path exactly when n-1 pairs of its squares are neighbours.
+func (bs *BitSolver) validate() bool {
+	w := uint(bs.width)
+	for i := 0; i < bs.pairs; i++ {
+		flow := uint64(0)
+		prev, pos := -1, bs.first[i]
+		for {
+			flow |= 1 << uint(pos)
+			if pos != bs.first[i] && bs.source&(1<<uint(pos)) != 0 {
+				break
+			}
+			for _, dir := range DIRS {
+				if bs.Con[pos]&dir != 0 && pos+bs.vctr[dir] != prev {
+					prev, pos = pos, pos+bs.vctr[dir]
+					break
+				}
+			}
+		}
+		touching := bits.OnesCount64(flow&(flow>>1)&bs.notEast) + bits.OnesCount64(flow&(flow>>w))
+		if touching != bits.OnesCount64(flow)-1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Solve a paper of at most 64 squares using bitboards. The result is copied
+// back into paper.Con. Larger papers, and papers with holes, bridges or
+// joined edges, are handed to Solve.
+func SolveBits(paper *Paper) bool {
+	w, h := paper.Width-2, paper.Height-2
+	if w*h > MaxBitSquares || paper.holes() || paper.bridges() || paper.Wrap != FLAT {
+		return Solve(paper)
+	}
+	pairs, ok := findPairs(paper)
+	if !ok {
+		return false
+	}
+	// Convert positions inside the grass to bitboard squares
+	square := func(pos int) int {
+		return (pos/paper.Width-1)*w + pos%paper.Width - 1
+	}
+	sources := make([][2]int, len(pairs))
+	for i, p := range pairs {
+		sources[i] = [2]int{square(p.a), square(p.b)}
+	}
+	bs := NewBitSolver(w, h)
+	if !bs.Solve(sources) {
+		return false
+	}
+	bs.CopyTo(paper)
+	return true
+}
+
+// Copy the connections found by the last call to Solve into a paper of the
+// same size
+func (bs *BitSolver) CopyTo(paper *Paper) {
+	w := bs.width
+	for y := 0; y < bs.height; y++ {
+		for x := 0; x < w; x++ {
+			paper.SetCon((y+1)*paper.Width+x+1, bs.Con[y*w+x])
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestBitSolver(t *testing.T) {
+	tests := papertests
+	if !testing.Short() {
+		tests = append(tests, bigpapertests...)
+	}
+	for _, tt := range tests {
+		bs := NewBitSolver(tt.width, tt.height)
+		count := countSolvable(tt.width, tt.height, func(sources [][2]int) bool {
+			return bs.Solve(sources)
+		})
+		if count != tt.out {
+			t.Errorf("Expected %d, got %d for %x", tt.out, count, tt)
+		}
+	}
+}
+
+func TestSolveBits(t *testing.T) {
+	lines := []string{
+		"C...B",
+		"A.BA.",
+		"...C.",
+		".....",
+	}
+	p1, _ := Parse(5, 4, lines)
+	p2, _ := Parse(5, 4, lines)
+	if !Solve(p1) || !SolveBits(p2) {
+		t.Fatalf("Expected both solvers to solve the puzzle")
+	}
+	for pos := range p1.Table {
+		if p1.Con(pos) != p2.Con(pos) {
+			t.Errorf("Expected %d, got %d at position %d", p1.Con(pos), p2.Con(pos), pos)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import "fmt"
+
+type CheckError struct {
+	X, Y    int
+	Problem string
+}
+
+func (e *CheckError) Error() string {
+	return fmt.Sprintf("CheckError: '%s' at (%d,%d)", e.Problem, e.X, e.Y)
+}
+
+// Check that solution, a grid in the format of PrintSimple, solves the puzzle
+// loaded into paper. That is, every square is coloured, the sources, holes and
+// bridges are kept, coloured squares have their colour, drawn pieces are
+// lines of the flows, and each label forms a single path between its two
+// sources, which doesn't touch itself. Flows go straight over bridges, and two
+// different flows must cross at each. On wrapped papers, the squares across a
+// joined edge are neighbours. Returns the first problem found, reading the
+// squares row by row, or nil if the solution is fine.
+func Check(paper *Paper, solution []string) error {
+	w, h := paper.Width, paper.Height
+	if len(solution) != h-2 {
+		return &CheckError{0, 0, fmt.Sprintf("solution has %d lines, expected %d", len(solution), h-2)}
+	}
+	table := make([]rune, w*h)
+	for pos := range table {
+		table[pos] = GRASS
+	}
+	labels := make(map[rune]bool)
+	for pos, val := range paper.Table {
+		if paper.isSource(pos) {
+			labels[val] = true
+		}
+	}
+	for y, line := range solution {
+		row := []rune(line)
+		if len(row) != w-2 {
+			return &CheckError{0, y, fmt.Sprintf("line has %d squares, expected %d", len(row), w-2)}
+		}
+		for x, c := range row {
+			pos := (y+1)*w + x + 1
+			switch {
+			case paper.Table[pos] == GRASS && c != GRASS:
+				return &CheckError{x, y, fmt.Sprintf("hole is coloured %c", c)}
+			case paper.Table[pos] == BRIDGE && c != BRIDGE:
+				return &CheckError{x, y, fmt.Sprintf("bridge is coloured %c", c)}
+			case paper.Table[pos] == GRASS || paper.Table[pos] == BRIDGE:
+			case c == EMPTY:
+				return &CheckError{x, y, "square is not coloured"}
+			case paper.isSource(pos) && c != paper.Table[pos]:
+				return &CheckError{x, y, fmt.Sprintf("source %c is coloured %c", paper.Table[pos], c)}
+			case paper.colors[pos] != EMPTY && c != paper.colors[pos]:
+				return &CheckError{x, y, fmt.Sprintf("square marked %c is coloured %c", paper.colors[pos], c)}
+			case !labels[c]:
+				return &CheckError{x, y, fmt.Sprintf("label %c is not in the puzzle", c)}
+			}
+			table[pos] = c
+		}
+	}
+
+	// A path between two sources that doesn't touch itself, is exactly one
+	// where the sources have one neighbour of the same colour, and all other
+	// squares have two
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			pos := y*w + x
+			if table[pos] == GRASS {
+				continue
+			}
+			if table[pos] == BRIDGE {
+				hflow, vflow := table[paper.across(pos, W)], table[paper.across(pos, N)]
+				if hflow != table[paper.across(pos, E)] || vflow != table[paper.across(pos, S)] || hflow == GRASS || vflow == GRASS {
+					return &CheckError{x - 1, y - 1, "bridge isn't crossed by two flows"}
+				}
+				if hflow == vflow {
+					return &CheckError{x - 1, y - 1, fmt.Sprintf("flow %c crosses itself", hflow)}
+				}
+				continue
+			}
+			for _, dir := range DIRS {
+				if int(paper.cells[pos].fixed)&dir != 0 && table[paper.across(pos, dir)] != table[pos] {
+					return &CheckError{x - 1, y - 1, "drawn piece isn't part of a flow"}
+				}
+			}
+			same := 0
+			for _, dir := range DIRS {
+				if table[paper.across(pos, dir)] == table[pos] {
+					same++
+				}
+			}
+			want := 2
+			if paper.isSource(pos) {
+				want = 1
+			}
+			if same > want {
+				return &CheckError{x - 1, y - 1, fmt.Sprintf("flow %c touches itself", table[pos])}
+			}
+			if same < want {
+				return &CheckError{x - 1, y - 1, fmt.Sprintf("flow %c is broken", table[pos])}
+			}
+		}
+	}
+
+	// That leaves loops separate from the flows. Walk each flow from its
+	// first source, and see that it covers every square of its colour.
+	seen := make([]bool, w*h)
+	for pos := range table {
+		if !paper.isSource(pos) || seen[pos] {
+			continue
+		}
+		for p, old := pos, -1; !seen[p]; {
+			seen[p] = true
+			for _, dir := range DIRS {
+				if next := paper.across(p, dir); next != old && table[next] == table[p] {
+					old, p = p, next
+					break
+				}
+			}
+		}
+	}
+	for pos := range table {
+		if table[pos] != GRASS && table[pos] != BRIDGE && !seen[pos] {
+			return &CheckError{pos%w - 1, pos/w - 1, fmt.Sprintf("flow %c has a loop not connected to its sources", table[pos])}
+		}
+	}
+	return nil
+}
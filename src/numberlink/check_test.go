@@ -0,0 +1,168 @@
+package main
+
+import "testing"
+
+var checktests = []struct {
+	puzzle   []string
+	solution []string
+	problem  string
+}{
+	{[]string{
+		"C...B",
+		"A.BA.",
+		"...C.",
+		".....",
+	}, []string{
+		"CCBBB",
+		"ACBAA",
+		"ACCCA",
+		"AAAAA",
+	}, ""},
+	{[]string{
+		"C...B",
+		"A.BA.",
+		"...C.",
+		".....",
+	}, []string{
+		"CCBBB",
+		"ACBAA",
+		"ACCCA",
+		"AAAA.",
+	}, "CheckError: 'square is not coloured' at (4,3)"},
+	{[]string{
+		"C...B",
+		"A.BA.",
+		"...C.",
+		".....",
+	}, []string{
+		"CCBBB",
+		"ACBAA",
+		"ACCAA",
+		"AAAAA",
+	}, "CheckError: 'source C is coloured A' at (3,2)"},
+	{[]string{
+		"C...B",
+		"A.BA.",
+		"...C.",
+		".....",
+	}, []string{
+		"CCBBB",
+		"ACBAA",
+		"ACCCA",
+		"AAAAD",
+	}, "CheckError: 'label D is not in the puzzle' at (4,3)"},
+	{[]string{
+		"....",
+		".ab.",
+		"..b.",
+		"a...",
+	}, []string{
+		"aaaa",
+		"aaba",
+		"aaba",
+		"aaaa",
+	}, "CheckError: 'flow a touches itself' at (1,0)"},
+	{[]string{
+		"a.a",
+		"b.b",
+	}, []string{
+		"aba",
+		"bbb",
+	}, "CheckError: 'flow a is broken' at (0,0)"},
+	{[]string{
+		"a..",
+		"b#a",
+		"..b",
+	}, []string{
+		"aaa",
+		"b#a",
+		"bbb",
+	}, ""},
+	{[]string{
+		"a..",
+		"b#a",
+		"..b",
+	}, []string{
+		"aaa",
+		"bba",
+		"bbb",
+	}, "CheckError: 'hole is coloured b' at (1,1)"},
+	{[]string{
+		"c..b",
+		"c̲bc.",
+		".aa.",
+		"....",
+	}, []string{
+		"cbbb",
+		"cbcc",
+		"caac",
+		"cccc",
+	}, ""},
+	{[]string{
+		"c..b",
+		"c̲bc.",
+		".aa.",
+		"....",
+	}, []string{
+		"cccb",
+		"bbcb",
+		"baab",
+		"bbbb",
+	}, "CheckError: 'square marked c is coloured b' at (0,1)"},
+	{[]string{
+		"c─.b",
+		".bc.",
+		".aa.",
+		"....",
+	}, []string{
+		"cccb",
+		"bbcb",
+		"baab",
+		"bbbb",
+	}, ""},
+	{[]string{
+		"c─.b",
+		".bc.",
+		".aa.",
+		"....",
+	}, []string{
+		"cbbb",
+		"cbcc",
+		"caac",
+		"cccc",
+	}, "CheckError: 'drawn piece isn't part of a flow' at (1,0)"},
+	{[]string{
+		"d.d",
+		"aba",
+		".┼.",
+		".┼.",
+		"cbc",
+	}, []string{
+		"ddd",
+		"aba",
+		"a┼a",
+		"c┼c",
+		"cbc",
+	}, ""},
+	{[]string{
+		"a.a",
+		"b┼b",
+	}, []string{
+		"aaa",
+		"b┼b",
+	}, "CheckError: 'bridge isn't crossed by two flows' at (1,1)"},
+}
+
+func TestCheck(t *testing.T) {
+	for _, test := range checktests {
+		p, _ := Parse(len([]rune(test.puzzle[0])), len(test.puzzle), test.puzzle)
+		err := Check(p, test.solution)
+		problem := ""
+		if err != nil {
+			problem = err.Error()
+		}
+		if problem != test.problem {
+			t.Errorf("Expected '%s' for %v, got '%s'", test.problem, test.solution, problem)
+		}
+	}
+}
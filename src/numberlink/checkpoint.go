@@ -0,0 +1,136 @@
+package main
+
+import "encoding/json"
+import "fmt"
+import "io/ioutil"
+import "os"
+import "time"
+
+// A saved position of a running search. Since the search is deterministic,
+// the branch being tried at each square along the diagonal order is enough
+// to get back to the same position, simply by replaying them. We save Con and
+// end as well, to check that the replay ends up in the same state.
+type Checkpoint struct {
+	// Which puzzle of the input was being solved, counting from 0
+	Puzzle int
+	Width  int
+	Height int
+	Lines  []string
+	// The square the search was at, and the number of calls made so far
+	Pos   int
+	Calls int
+	// The branch tried at each square before Pos in the diagonal order
+	Branches []uint8
+	Con      []uint8
+	End      []int32
+}
+
+// Save the current position of the search, which must be at pos
+func (paper *Paper) Checkpoint(puzzle int, pos int) *Checkpoint {
+	cp := &Checkpoint{
+		Puzzle: puzzle,
+		Width:  paper.Width - 2,
+		Height: paper.Height - 2,
+		Lines:  paper.lines(),
+		Pos:    pos,
+		Calls:  Calls,
+		Con:    make([]uint8, len(paper.cells)),
+		End:    make([]int32, len(paper.cells)),
+	}
+	for p := paper.first(); p != pos && p != 0; p = int(paper.cells[p].next) {
+		cp.Branches = append(cp.Branches, paper.cells[p].branch)
+	}
+	for p, c := range paper.cells {
+		cp.Con[p], cp.End[p] = c.con, c.end
+	}
+	return cp
+}
+
+// The puzzle, without the grass border
+func (paper *Paper) lines() []string {
+	lines := make([]string, 0, paper.Height-2)
+	for y := 1; y < paper.Height-1; y++ {
+		lines = append(lines, string(paper.Table[y*paper.Width+1:(y+1)*paper.Width-1]))
+	}
+	return lines
+}
+
+// Make the next search on the paper continue from the checkpoint. The paper
+// must have been loaded with the same puzzle, and not searched yet.
+func (paper *Paper) Resume(cp *Checkpoint) error {
+	lines := paper.lines()
+	same := cp.Width == paper.Width-2 && cp.Height == paper.Height-2 && len(cp.Lines) == len(lines)
+	for i := 0; same && i < len(lines); i++ {
+		same = cp.Lines[i] == lines[i]
+	}
+	if !same || len(cp.Con) != len(paper.cells) || len(cp.End) != len(paper.cells) {
+		return fmt.Errorf("Error: Checkpoint is for a different puzzle")
+	}
+	p := paper.first()
+	for _, branch := range cp.Branches {
+		if p == 0 {
+			return fmt.Errorf("Error: Checkpoint has too many branches")
+		}
+		paper.cells[p].branch = branch
+		p = int(paper.cells[p].next)
+	}
+	if p != cp.Pos {
+		return fmt.Errorf("Error: Checkpoint branches don't lead to its position")
+	}
+	paper.replaying, paper.resumeAt, paper.resumed = true, cp.Pos, cp
+	return nil
+}
+
+// Called when the replay has got back to the position of the checkpoint
+func (paper *Paper) finishReplay() {
+	cp := paper.resumed
+	paper.replaying, paper.resumed = false, nil
+	for p, c := range paper.cells {
+		if c.con != cp.Con[p] || c.end != cp.End[p] {
+			paper.stop = true
+			paper.err = fmt.Errorf("Error: Replaying the checkpoint didn't give the saved state")
+			return
+		}
+	}
+	Calls = cp.Calls
+}
+
+// Write the checkpoint to a file. The file is replaced atomically, so a crash
+// while saving leaves the previous checkpoint intact.
+func (cp *Checkpoint) Save(file string) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(file+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+func LoadCheckpoint(file string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	cp := new(Checkpoint)
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// Makes a ticker that saves the search of the given puzzle to file, at most
+// once every interval
+func Checkpointer(file string, puzzle int, interval time.Duration) func(*Paper, int) {
+	last := time.Now()
+	return func(paper *Paper, pos int) {
+		if paper.replaying || time.Since(last) < interval {
+			return
+		}
+		last = time.Now()
+		if err := paper.Checkpoint(puzzle, pos).Save(file); err != nil {
+			paper.stop, paper.err = true, err
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import "path/filepath"
+import "testing"
+
+var checkpointtest = []string{
+	".....LE.......",
+	".M......F.....",
+	"...K..........",
+	"...I......N.F.",
+	"....K.........",
+	"..B.....H.....",
+	"..........B...",
+	".M.C...P.D....",
+	".............H",
+	"O.............",
+	".G.C...PD..GJ.",
+	"...L..........",
+	".OI...N.....J.",
+	"............E.",
+}
+
+func TestResume(t *testing.T) {
+	defer func(mask int) { TICK_MASK = mask }(TICK_MASK)
+	TICK_MASK = 1<<6 - 1
+
+	// Solve the puzzle without interruptions
+	p1, _ := Parse(14, 14, checkpointtest)
+	Calls = 0
+	res1 := Solve(p1)
+	calls1 := Calls
+
+	// Crash halfway through the search, and save the position
+	file := filepath.Join(t.TempDir(), "checkpoint")
+	p2, _ := Parse(14, 14, checkpointtest)
+	p2.tickers = append(p2.tickers, func(paper *Paper, pos int) {
+		if Calls >= calls1/2 && !paper.stop {
+			if err := paper.Checkpoint(0, pos).Save(file); err != nil {
+				t.Fatal(err.Error())
+			}
+			paper.stop = true
+		}
+	})
+	Calls = 0
+	if Solve(p2) || !p2.stop {
+		t.Fatalf("Expected the search to be stopped")
+	}
+
+	// Continue from the checkpoint
+	cp, err := LoadCheckpoint(file)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	p3, _ := Parse(14, 14, checkpointtest)
+	if err := p3.Resume(cp); err != nil {
+		t.Fatal(err.Error())
+	}
+	Calls = 0
+	res3 := Solve(p3)
+	if p3.err != nil {
+		t.Fatal(p3.err.Error())
+	}
+	if res1 != res3 || calls1 != Calls {
+		t.Errorf("Expected %t after %d calls, got %t after %d calls", res1, calls1, res3, Calls)
+	}
+	for pos := range p1.Table {
+		if p1.Con(pos) != p3.Con(pos) {
+			t.Errorf("Resumed solution differs at position %d", pos)
+			break
+		}
+	}
+
+	// A checkpoint can't be used for another puzzle
+	p4, _ := Parse(5, 4, []string{"C...B", "A.BA.", "...C.", "....."})
+	if p4.Resume(cp) == nil {
+		t.Errorf("Expected an error resuming a different puzzle")
+	}
+}
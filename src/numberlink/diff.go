@@ -0,0 +1,125 @@
+package main
+
+import "fmt"
+import "sort"
+
+// The differences between two solutions of the same puzzle
+type SolutionDiff struct {
+	// The labels taking a different route in the two solutions
+	Labels []rune
+	// The squares owned by a different label, in reading order
+	Squares []SquareChange
+	// The second solution as a solved paper, for printing
+	second *Paper
+}
+
+type SquareChange struct {
+	X, Y     int
+	From, To rune
+}
+
+// Compare two solutions in the format of PrintSimple. Both must be valid
+// solutions of the same puzzle.
+func Diff(a, b []string) (*SolutionDiff, error) {
+	puzzleA, err := Extract(a)
+	if err != nil {
+		return nil, err
+	}
+	puzzleB, err := Extract(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(puzzleA) != len(puzzleB) {
+		return nil, fmt.Errorf("Error: Solutions are of different puzzles")
+	}
+	for y := range puzzleA {
+		if puzzleA[y] != puzzleB[y] {
+			return nil, fmt.Errorf("Error: Solutions are of different puzzles")
+		}
+	}
+
+	second, err := solutionPaper(b)
+	if err != nil {
+		return nil, err
+	}
+	diff := &SolutionDiff{Squares: make([]SquareChange, 0), second: second}
+	changed := make(map[rune]bool)
+	for y := range a {
+		rowA, rowB := []rune(a[y]), []rune(b[y])
+		for x := range rowA {
+			if rowA[x] != rowB[x] {
+				diff.Squares = append(diff.Squares, SquareChange{x, y, rowA[x], rowB[x]})
+				changed[rowA[x]], changed[rowB[x]] = true, true
+			}
+		}
+	}
+	for label := range changed {
+		diff.Labels = append(diff.Labels, label)
+	}
+	sort.Slice(diff.Labels, func(i, j int) bool { return diff.Labels[i] < diff.Labels[j] })
+	return diff, nil
+}
+
+// Make a solved paper from a solution in the format of PrintSimple
+func solutionPaper(solution []string) (*Paper, error) {
+	puzzle, err := Extract(solution)
+	if err != nil {
+		return nil, err
+	}
+	paper, err := Parse(len([]rune(solution[0])), len(solution), puzzle)
+	if err != nil {
+		return nil, err
+	}
+	table := make([]rune, 0, len(paper.Table))
+	for _, line := range solution {
+		table = append(table, []rune(line)...)
+	}
+	w := paper.Width - 2
+	for i, c := range table {
+		pos := (i/w+1)*paper.Width + i%w + 1
+		if i%w+1 < w && table[i+1] == c {
+			paper.connect(pos, E)
+		}
+		if i+w < len(table) && table[i+w] == c {
+			paper.connect(pos, S)
+		}
+	}
+	return paper, nil
+}
+
+// Print the labels taking different routes and the squares changing owner,
+// followed by the second solution with the changed squares highlighted. With
+// color, the changed squares are drawn in their colors from PrintSimple, and
+// the rest are left plain. Without, the rest are drawn as empty squares,
+// except for sources, holes and bridges.
+func PrintDiff(diff *SolutionDiff, color bool) {
+	if len(diff.Squares) == 0 {
+		fmt.Println("SAME")
+		return
+	}
+	fmt.Printf("Different routes: %s\n", listLabels(diff.Labels))
+	for _, sq := range diff.Squares {
+		fmt.Printf("(%d,%d) %c -> %c\n", sq.X, sq.Y, sq.From, sq.To)
+	}
+	paper := diff.second
+	colors := makeColorTable(paper, !color)
+	table := fillTable(paper)
+	changed := make(map[int]bool)
+	for _, sq := range diff.Squares {
+		changed[(sq.Y+1)*paper.Width+sq.X+1] = true
+	}
+	for y := 1; y < paper.Height-1; y++ {
+		for x := 1; x < paper.Width-1; x++ {
+			pos := y*paper.Width + x
+			switch {
+			case changed[pos] && color:
+				fmt.Printf("%s%s%c%s", colors[pos], REVERSE, table[pos], RESET)
+			case changed[pos] || paper.isSource(pos) || paper.Table[pos] == GRASS || paper.Table[pos] == BRIDGE || color:
+				fmt.Printf("%c", table[pos])
+			default:
+				fmt.Printf("%c", EMPTY)
+			}
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import "fmt"
+import "testing"
+
+var difftests = []struct {
+	a, b    []string
+	labels  string
+	squares int
+	problem string
+}{
+	{[]string{
+		"cbbb",
+		"cbcc",
+		"caac",
+		"cccc",
+	}, []string{
+		"cccb",
+		"bbcb",
+		"baab",
+		"bbbb",
+	}, "bc", 10, ""},
+	{[]string{
+		"aab",
+		"bbb",
+	}, []string{
+		"aab",
+		"bbb",
+	}, "", 0, ""},
+	{[]string{
+		"aab",
+		"bbb",
+	}, []string{
+		"aaa",
+		"bbb",
+	}, "", 0, "Error: Solutions are of different puzzles"},
+}
+
+func TestDiff(t *testing.T) {
+	for _, test := range difftests {
+		diff, err := Diff(test.a, test.b)
+		if err != nil {
+			if err.Error() != test.problem {
+				t.Errorf("Expected '%s' for %v and %v, got '%s'", test.problem, test.a, test.b, err.Error())
+			}
+			continue
+		}
+		if test.problem != "" || string(diff.Labels) != test.labels || len(diff.Squares) != test.squares {
+			t.Errorf("Expected %s and %d squares for %v and %v, got %s and %v", test.labels, test.squares, test.a, test.b, string(diff.Labels), diff.Squares)
+		}
+	}
+}
+
+func TestDiffSquares(t *testing.T) {
+	diff, _ := Diff(difftests[0].a, difftests[0].b)
+	if got := fmt.Sprint(diff.Squares[0]); got != "{1 0 98 99}" {
+		t.Errorf("Expected the first change at (1,0) from b to c, got %s", got)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+// Call found with the paper holding each solution of the puzzle, until it
+// returns false. Returns the number of solutions found. When it returns, the
+// paper holds the last solution if found stopped the search, and is empty
+// otherwise.
+func EachSolution(paper *Paper, found func(paper *Paper) bool) int {
+	count := 0
+	paper.onSolution = func(paper *Paper) bool {
+		count++
+		return !found(paper)
+	}
+	Solve(paper)
+	paper.onSolution = nil
+	return count
+}
+
+// Count the solutions of the puzzle, stopping at limit
+func CountSolutions(paper *Paper, limit int) int {
+	return EachSolution(paper, func(*Paper) bool {
+		limit--
+		return limit > 0
+	})
+}
@@ -0,0 +1,39 @@
+package main
+
+import "strings"
+import "testing"
+
+func TestEachSolution(t *testing.T) {
+	p, _ := Parse(4, 4, []string{
+		"c..b",
+		".bc.",
+		".aa.",
+		"....",
+	})
+	solutions := make([]string, 0)
+	count := EachSolution(p, func(p *Paper) bool {
+		solutions = append(solutions, strings.Join(p.Letters(), "\n"))
+		return true
+	})
+	if count != 2 || len(solutions) != 2 {
+		t.Fatalf("Expected 2 solutions, got %d", count)
+	}
+	if solutions[0] == solutions[1] {
+		t.Error("Expected the solutions to differ")
+	}
+	for _, s := range solutions {
+		q, _ := Parse(4, 4, []string{"c..b", ".bc.", ".aa.", "...."})
+		if err := Check(q, strings.Split(s, "\n")); err != nil {
+			t.Error(err.Error())
+		}
+	}
+
+	p, _ = Parse(4, 4, []string{"c..b", ".bc.", ".aa.", "...."})
+	if count := CountSolutions(p, 1); count != 1 {
+		t.Errorf("Expected counting to stop at 1, got %d", count)
+	}
+	p, _ = Parse(14, 14, checkpointtest)
+	if count := CountSolutions(p, 2); count != 1 {
+		t.Errorf("Expected a unique solution, got %d", count)
+	}
+}
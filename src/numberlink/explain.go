@@ -0,0 +1,162 @@
+package main
+
+import "fmt"
+import "strings"
+
+// Why a puzzle can't be solved
+type Diagnosis struct {
+	Reasons []string
+	// The labels of a smallest set of pairs that can't all be connected, even
+	// when the paper doesn't have to be filled
+	Core []rune
+	// Squares that no flow can reach
+	Region []int
+}
+
+// Explain why the puzzle on the paper, which must be known to be impossible,
+// can't be solved. The problems found by Analyze are given if there are any,
+// since they are much easier to understand. The search below only knows about
+// the labels, so if the puzzle can be solved without its drawn pieces and
+// coloured squares, those are the reason.
+//
+// Finding the smallest conflicting set of pairs for the real puzzle doesn't
+// make sense, since a puzzle can get harder by removing pairs, when the rest
+// have to fill the paper. Instead we look for a set of pairs which can't be
+// connected at all, with the sources of the other pairs acting as walls. Such
+// a set can only get easier by removing pairs, so we start with all of them,
+// and drop every pair the rest still conflict without.
+func Explain(paper *Paper) *Diagnosis {
+	if problems := Analyze(paper); len(problems) != 0 {
+		return &Diagnosis{Reasons: problems}
+	}
+	if paper.constrained() && Solve(NewPaper(paper.Width-2, paper.Height-2, paper.flatten())) {
+		return &Diagnosis{Reasons: []string{"The puzzle can only be solved without its drawn pieces and coloured squares"}}
+	}
+	pairs, _ := findPairs(paper)
+	if canRoute(paper, pairs) {
+		d := &Diagnosis{}
+		d.Region = unreachable(paper, pairs)
+		if len(d.Region) != 0 {
+			d.Reasons = []string{"Some squares can't be reached by any pair"}
+		} else {
+			d.Reasons = []string{"Every pair can be connected, but not while filling the paper"}
+		}
+		return d
+	}
+
+	core := append([]pair(nil), pairs...)
+	for i := 0; i < len(core); {
+		rest := append(append([]pair(nil), core[:i]...), core[i+1:]...)
+		if !canRoute(paper, rest) {
+			core = rest
+		} else {
+			i++
+		}
+	}
+	d := &Diagnosis{}
+	for _, p := range core {
+		d.Core = append(d.Core, p.label)
+	}
+	if len(core) == 1 {
+		d.Reasons = []string{fmt.Sprintf("The %c pair can't be connected", core[0].label)}
+	} else {
+		d.Reasons = []string{fmt.Sprintf("The %s pairs can't all be connected", listLabels(d.Core))}
+	}
+	return d
+}
+
+// Check if the pairs can be connected by paths not crossing each other,
+// without filling the paper
+func canRoute(paper *Paper, pairs []pair) bool {
+	scratch := NewPaper(paper.Width-2, paper.Height-2, paper.flatten())
+	return newFlowSearch(scratch, append([]pair(nil), pairs...), true).search()
+}
+
+// The puzzle as a single table without the grass border, like Parse makes
+func (paper *Paper) flatten() []rune {
+	table := make([]rune, 0, (paper.Width-2)*(paper.Height-2))
+	for _, line := range paper.lines() {
+		table = append(table, []rune(line)...)
+	}
+	return table
+}
+
+// Find the empty squares in regions with no pair having both ends next to it
+func unreachable(paper *Paper, pairs []pair) []int {
+	fs := newFlowSearch(paper, pairs, true)
+	fs.coverable()
+	reached := make(map[int]bool)
+	for _, p := range pairs {
+		for _, dir := range DIRS {
+			r := fs.region[p.a+paper.Vctr[dir]]
+			if r != -1 && fs.touchesRegion(p.b, r) {
+				reached[r] = true
+			}
+		}
+	}
+	region := make([]int, 0)
+	for pos, r := range fs.region {
+		if r != -1 && !reached[r] {
+			region = append(region, pos)
+		}
+	}
+	return region
+}
+
+// Joins labels like "a, b and c"
+func listLabels(labels []rune) string {
+	names := make([]string, len(labels))
+	for i, label := range labels {
+		names[i] = string(label)
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// Print the reasons, followed by the paper with the conflict highlighted.
+// Sources of pairs in the core are kept, while other sources, which only act
+// as walls, are shown as #. Unreachable squares are shown as !. Drawn pieces
+// and coloured squares are shown as in the puzzle. With color, the core and
+// the region are also shown in reverse video.
+func PrintDiagnosis(paper *Paper, d *Diagnosis, color bool) {
+	fmt.Println("IMPOSSIBLE:", d.Reasons[0])
+	for _, reason := range d.Reasons[1:] {
+		fmt.Println("           ", reason)
+	}
+	inCore := make(map[rune]bool)
+	for _, label := range d.Core {
+		inCore[label] = true
+	}
+	inRegion := make(map[int]bool)
+	for _, pos := range d.Region {
+		inRegion[pos] = true
+	}
+	for y := 1; y < paper.Height-1; y++ {
+		for x := 1; x < paper.Width-1; x++ {
+			pos := y*paper.Width + x
+			c, mark, colored := paper.Table[pos], false, ""
+			switch {
+			case inRegion[pos]:
+				c, mark = '!', true
+			case paper.isSource(pos) && len(d.Core) != 0:
+				if inCore[c] {
+					mark = true
+				} else {
+					c = GRASS
+				}
+			case paper.cells[pos].fixed != 0:
+				c = TUBE[paper.cells[pos].fixed]
+			case paper.colors[pos] != EMPTY:
+				c, colored = paper.colors[pos], string(COLORED)
+			}
+			if mark && color {
+				fmt.Printf("%s%c%s%s", REVERSE, c, colored, RESET)
+			} else {
+				fmt.Printf("%c%s", c, colored)
+			}
+		}
+		fmt.Println()
+	}
+}
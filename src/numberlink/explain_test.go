@@ -0,0 +1,80 @@
+package main
+
+import "testing"
+
+var explaintests = []struct {
+	lines  []string
+	core   string
+	region int
+}{
+	// The b pair is walled in by the c pair
+	{[]string{
+		"abc",
+		"...",
+		"acb",
+	}, "bc", 0},
+	// The c pair is cut off by the sources of b and d
+	{[]string{
+		"....",
+		"bdc.",
+		"c.bd",
+		"aa..",
+	}, "c", 0},
+	// The a and b pairs must cross
+	{[]string{
+		"a..",
+		"..b",
+		"b.a",
+	}, "ab", 0},
+	// The two squares in the upper left corner can't be reached
+	{[]string{
+		".cca",
+		".bb.",
+		"a...",
+		"....",
+	}, "", 2},
+	// Found without searching
+	{[]string{
+		"aa..",
+	}, "", 0},
+	// Touching flows
+	{[]string{
+		"....",
+		".ab.",
+		"..b.",
+		"a...",
+	}, "", 0},
+}
+
+// Puzzles that can only be solved without their drawn pieces or coloured
+// squares
+func TestExplainConstraints(t *testing.T) {
+	for _, lines := range [][]string{
+		{"c..b", ".bc.", ".aa.", "a̲..."},
+		{"c..b", "b̲bc.", ".aa.", "...c̲"},
+		{"c..b", ".bc.", ".aa┐", "...."},
+	} {
+		p, _ := Parse(4, 4, lines)
+		if Solve(p) {
+			t.Fatalf("Expected %v to be impossible", lines)
+		}
+		d := Explain(p)
+		if d.Reasons[0] != "The puzzle can only be solved without its drawn pieces and coloured squares" {
+			t.Errorf("Unexpected reasons %v for %v", d.Reasons, lines)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	for _, test := range explaintests {
+		p, _ := Parse(len(test.lines[0]), len(test.lines), test.lines)
+		if Solve(p) {
+			t.Fatalf("Expected %v to be impossible", test.lines)
+		}
+		d := Explain(p)
+		if string(d.Core) != test.core || len(d.Region) != test.region {
+			t.Errorf("Expected core '%s' and region of %d for %v, got '%s' and %d (%s)",
+				test.core, test.region, test.lines, string(d.Core), len(d.Region), d.Reasons)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import "fmt"
+
+// Find the puzzle solved by a grid in the format of PrintSimple. Every square
+// must be coloured, and every colour must form a single path which doesn't
+// touch itself. The ends of the paths become the sources of the puzzle, and
+// the rest of the squares are left empty, except for holes and bridges which
+// are kept.
+func Extract(solution []string) ([]string, error) {
+	if len(solution) == 0 {
+		return nil, &CheckError{0, 0, "solution is empty"}
+	}
+	table := make([][]int, len(solution))
+	for y, line := range solution {
+		for _, c := range line {
+			table[y] = append(table[y], int(c))
+		}
+		if len(table[y]) != len(table[0]) {
+			return nil, &CheckError{0, y, fmt.Sprintf("line has %d squares, expected %d", len(table[y]), len(table[0]))}
+		}
+	}
+
+	// The heads of the flows, like when generating puzzles
+	puzzle := make([]string, len(solution))
+	heads := make(map[int]int)
+	for y, row := range table {
+		line := make([]rune, len(row))
+		for x, c := range row {
+			if c == EMPTY {
+				return nil, &CheckError{x, y, "square is not coloured"}
+			}
+			line[x] = EMPTY
+			if c == GRASS || c == BRIDGE {
+				line[x] = rune(c)
+			} else if isFlowHead(x, y, table) {
+				line[x] = rune(c)
+				heads[c]++
+			}
+		}
+		puzzle[y] = string(line)
+	}
+	for y, row := range table {
+		for x, c := range row {
+			if c != GRASS && c != BRIDGE && heads[c] != 2 {
+				return nil, &CheckError{x, y, fmt.Sprintf("flow %c has %d ends", c, heads[c])}
+			}
+		}
+	}
+
+	// The checker takes care of the rest
+	paper, err := Parse(len(table[0]), len(table), puzzle)
+	if err != nil {
+		return nil, err
+	}
+	if err := Check(paper, solution); err != nil {
+		return nil, err
+	}
+	return puzzle, nil
+}
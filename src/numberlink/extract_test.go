@@ -0,0 +1,79 @@
+package main
+
+import "strings"
+import "testing"
+
+var extracttests = []struct {
+	solution []string
+	puzzle   []string
+	problem  string
+}{
+	{[]string{
+		"CCBBB",
+		"ACBAA",
+		"ACCCA",
+		"AAAAA",
+	}, []string{
+		"C...B",
+		"A.BA.",
+		"...C.",
+		".....",
+	}, ""},
+	{[]string{
+		"aab",
+		"bbb",
+	}, []string{
+		"aab",
+		"b..",
+	}, ""},
+	{[]string{
+		"aa",
+		"aa",
+	}, nil, "CheckError: 'flow a has 0 ends' at (0,0)"},
+	{[]string{
+		"aab",
+		"b.b",
+	}, nil, "CheckError: 'square is not coloured' at (1,1)"},
+	{[]string{
+		"aaa",
+		"baa",
+		"aab",
+	}, nil, "CheckError: 'flow a touches itself' at (1,0)"},
+	{[]string{
+		"abbbb",
+		"ab..b",
+		"abbbb",
+		"aaaaa",
+	}, nil, "CheckError: 'square is not coloured' at (2,1)"},
+	{[]string{
+		"aaa",
+		"b#a",
+		"bbb",
+	}, []string{
+		"a..",
+		"b#a",
+		"..b",
+	}, ""},
+	{[]string{
+		"aab",
+		"b┼b",
+		"baa",
+	}, []string{
+		"a.b",
+		".┼.",
+		"b.a",
+	}, ""},
+}
+
+func TestExtract(t *testing.T) {
+	for _, test := range extracttests {
+		puzzle, err := Extract(test.solution)
+		problem := ""
+		if err != nil {
+			problem = err.Error()
+		}
+		if problem != test.problem || strings.Join(puzzle, "\n") != strings.Join(test.puzzle, "\n") {
+			t.Errorf("Expected %v and '%s' for %v, got %v and '%s'", test.puzzle, test.problem, test.solution, puzzle, problem)
+		}
+	}
+}
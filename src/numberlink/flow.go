@@ -0,0 +1,315 @@
+package main
+
+// An alternative backend that routes one label at a time instead of sweeping
+// the paper diagonally. On papers with little structure for the corner dual
+// to exploit (such as many internal walls), committing to whole flows and
+// pruning on stranded regions is often the better strategy.
+//
+// The flow solver follows the same rules as Solve: every square must be
+// covered and no flow may touch itself. The result is stored in paper.Con, so
+// all the printers work as usual. Neighbours are found with paper.neighbour,
+// so flows may also cross the joined edges of wrapped papers.
+
+type pair struct {
+	label rune
+	a, b  int
+}
+
+type flowSearch struct {
+	paper *Paper
+	pairs []pair
+	// Only connect the pairs, without having to fill the paper
+	relaxed bool
+	// The label currently occupying each position
+	owner []rune
+	// Whether the pair has been routed
+	done []bool
+	// Whether the position is the head or goal of a pair not yet routed
+	isEnd []bool
+	// Scratch space for finding regions of empty squares
+	region  []int
+	queue   []int
+	covered []bool
+}
+
+// Find the two sources of each label, in order of first appearance.
+// Returns false if some label doesn't appear exactly twice.
+func findPairs(paper *Paper) ([]pair, bool) {
+	pairs := make([]pair, 0)
+	index := make(map[rune]int)
+	for pos, val := range paper.Table {
+		if !paper.isSource(pos) {
+			continue
+		}
+		if i, found := index[val]; !found {
+			index[val] = len(pairs)
+			pairs = append(pairs, pair{val, pos, -1})
+		} else if pairs[i].b == -1 {
+			pairs[i].b = pos
+		} else {
+			return pairs, false
+		}
+	}
+	for _, p := range pairs {
+		if p.b == -1 {
+			return pairs, false
+		}
+	}
+	return pairs, true
+}
+
+// Solve the paper by routing one flow at a time, always picking the most
+// constrained pair first
+func SolveFlows(paper *Paper) bool {
+	pairs, ok := findPairs(paper)
+	if !ok {
+		return false
+	}
+	return newFlowSearch(paper, pairs, false).search()
+}
+
+func newFlowSearch(paper *Paper, pairs []pair, relaxed bool) *flowSearch {
+	size := paper.Width * paper.Height
+	fs := &flowSearch{
+		paper:   paper,
+		pairs:   pairs,
+		relaxed: relaxed,
+		owner:   make([]rune, size),
+		done:    make([]bool, len(pairs)),
+		isEnd:   make([]bool, size),
+		region:  make([]int, size),
+		queue:   make([]int, 0, size),
+	}
+	copy(fs.owner, paper.Table)
+	for _, p := range pairs {
+		fs.isEnd[p.a], fs.isEnd[p.b] = true, true
+	}
+	return fs
+}
+
+func (fs *flowSearch) search() bool {
+	if !fs.coverable() {
+		return false
+	}
+	return fs.route(len(fs.pairs))
+}
+
+// Pick the next pair to route and try every path for it
+func (fs *flowSearch) route(left int) bool {
+	Calls++
+
+	// Final
+	if left == 0 {
+		return true
+	}
+
+	// The most constrained pair is the one with an end having fewest exits
+	best, bestExits, swap := -1, 5, false
+	for i, p := range fs.pairs {
+		if fs.done[i] {
+			continue
+		}
+		ea, eb := fs.exits(p.a, p.b), fs.exits(p.b, p.a)
+		if ea == 0 || eb == 0 {
+			return false
+		}
+		if ea < bestExits {
+			best, bestExits, swap = i, ea, false
+		}
+		if eb < bestExits {
+			best, bestExits, swap = i, eb, true
+		}
+	}
+
+	// We always extend from a, so make that the most constrained end
+	p := &fs.pairs[best]
+	if swap {
+		p.a, p.b = p.b, p.a
+	}
+	res := fs.extend(best, left)
+	if swap && !res {
+		p.a, p.b = p.b, p.a
+	}
+	return res
+}
+
+// Count the directions the flow at head can be extended in
+func (fs *flowSearch) exits(head, goal int) int {
+	count := 0
+	for _, dir := range DIRS {
+		next := fs.paper.neighbour(head, dir)
+		if next == goal || fs.owner[next] == EMPTY {
+			count++
+		}
+	}
+	return count
+}
+
+// Extend the flow of the i'th pair from its a end, until it reaches its b end.
+// While extending, a is moved along to always point at the head of the flow.
+func (fs *flowSearch) extend(i int, left int) bool {
+	Calls++
+	paper := fs.paper
+	p := &fs.pairs[i]
+	head := p.a
+
+	// If we are next to the goal, going anywhere else would make the flow
+	// touch itself
+	for _, dir := range DIRS {
+		if paper.neighbour(head, dir) == p.b {
+			paper.connect(head, dir)
+			fs.done[i] = true
+			fs.isEnd[head], fs.isEnd[p.b] = false, false
+			if fs.coverable() && fs.route(left-1) {
+				return true
+			}
+			fs.isEnd[head], fs.isEnd[p.b] = true, true
+			fs.done[i] = false
+			paper.disconnect(head, dir)
+			return false
+		}
+	}
+
+	for _, dir := range DIRS {
+		next := paper.neighbour(head, dir)
+		if fs.owner[next] != EMPTY || fs.touches(next, head, p.label) {
+			continue
+		}
+		fs.owner[next] = p.label
+		paper.connect(head, dir)
+		p.a = next
+		fs.isEnd[head], fs.isEnd[next] = false, true
+		if (fs.relaxed || !fs.deadEnds(head)) && fs.coverable() && fs.extend(i, left) {
+			return true
+		}
+		fs.isEnd[head], fs.isEnd[next] = true, false
+		p.a = head
+		paper.disconnect(head, dir)
+		fs.owner[next] = EMPTY
+	}
+	return false
+}
+
+// Check if putting a flow with the given label at pos would make it touch
+// itself anywhere but at the head it came from
+func (fs *flowSearch) touches(pos, head int, label rune) bool {
+	for _, dir := range DIRS {
+		cand := fs.paper.neighbour(pos, dir)
+		if cand != head && fs.owner[cand] == label && !fs.isEnd[cand] {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if the empty squares around the old head have been left with too few
+// neighbours to ever get covered
+func (fs *flowSearch) deadEnds(head int) bool {
+	for _, dir := range DIRS {
+		pos := fs.paper.neighbour(head, dir)
+		if fs.owner[pos] == EMPTY && fs.openings(pos) < 2 {
+			return true
+		}
+	}
+	return false
+}
+
+// Count the neighbours of pos which a flow through pos could still use.
+// These are the empty squares and the ends of pairs not yet routed.
+func (fs *flowSearch) openings(pos int) int {
+	count := 0
+	for _, dir := range DIRS {
+		cand := fs.paper.neighbour(pos, dir)
+		if fs.owner[cand] == EMPTY || fs.isEnd[cand] {
+			count++
+		}
+	}
+	return count
+}
+
+// Check that every region of empty squares can still be covered, and that
+// every pair not yet routed can still reach each other.
+// Returns false if something is stranded.
+func (fs *flowSearch) coverable() bool {
+	paper := fs.paper
+	for pos := range fs.region {
+		fs.region[pos] = -1
+	}
+
+	// Label the regions of empty squares using bfs
+	regions := 0
+	for pos, val := range fs.owner {
+		if val != EMPTY || fs.region[pos] != -1 {
+			continue
+		}
+		fs.region[pos] = regions
+		fs.queue = append(fs.queue[:0], pos)
+		for len(fs.queue) != 0 {
+			p := fs.queue[len(fs.queue)-1]
+			fs.queue = fs.queue[:len(fs.queue)-1]
+			for _, dir := range DIRS {
+				next := paper.neighbour(p, dir)
+				if fs.owner[next] == EMPTY && fs.region[next] == -1 {
+					fs.region[next] = regions
+					fs.queue = append(fs.queue, next)
+				}
+			}
+		}
+		regions++
+	}
+
+	// Every region must be reachable by both ends of some pair, and every
+	// pair must have its ends in a common region
+	if cap(fs.covered) < regions {
+		fs.covered = make([]bool, regions)
+	}
+	covered := fs.covered[:regions]
+	for r := range covered {
+		covered[r] = false
+	}
+	for i, p := range fs.pairs {
+		if fs.done[i] {
+			continue
+		}
+		if fs.adjacent(p.a, p.b) {
+			continue
+		}
+		common := false
+		for _, dir := range DIRS {
+			r := fs.region[paper.neighbour(p.a, dir)]
+			if r != -1 && fs.touchesRegion(p.b, r) {
+				covered[r] = true
+				common = true
+			}
+		}
+		if !common {
+			return false
+		}
+	}
+	for _, c := range covered {
+		if !c && !fs.relaxed {
+			return false
+		}
+	}
+	return true
+}
+
+// Check if pos is next to a square in region r
+func (fs *flowSearch) touchesRegion(pos, r int) bool {
+	for _, dir := range DIRS {
+		if fs.region[fs.paper.neighbour(pos, dir)] == r {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if pos1 and pos2 are neighbours
+func (fs *flowSearch) adjacent(pos1, pos2 int) bool {
+	for _, dir := range DIRS {
+		if fs.paper.neighbour(pos1, dir) == pos2 {
+			return true
+		}
+	}
+	return false
+}
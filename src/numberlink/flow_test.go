@@ -0,0 +1,12 @@
+package main
+
+import "testing"
+
+func TestSolveFlows(t *testing.T) {
+	for _, tt := range papertests {
+		count := countSolvable(tt.width, tt.height, paperSolver(tt.width, tt.height, SolveFlows))
+		if count != tt.out {
+			t.Errorf("Expected %d, got %d for %x", tt.out, count, tt)
+		}
+	}
+}
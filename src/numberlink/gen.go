@@ -10,6 +10,9 @@ var (
 	DY    = [4]int{-1, 0, 1, 0}
 )
 
+// The value of holes in the tables of the generator, which no flow can use
+const HOLE_FLOW = -1
+
 func square(x int) int {
 	return x * x
 }
@@ -24,21 +27,27 @@ func square(x int) int {
 //    equal to 1
 // 3) Now, in the case of an odd area paper, the bottom right corner is
 //    attached to one of its neighbour dominos. This will always be possible.
+//    If holes are asked for, that many random dominos are cut out of the
+//    paper, leaving the rest still tiled.
 // 4) Finally we can start finding random paths through the dominos, combining
 //    them as we pass through. Special care is taken not to connect 'touching
 //    flows' which would create puzzles that 'double back on themselves'
 // 5) Before the puzzle is printed we 'compact' the range of colors used, as
 //    much as possible
 // 6) The puzzle is printed by replacing all positions that aren't flow-heads
-//    with a .
-func Generate(width, height int) ([]string, []string, error) {
+//    with a ., and holes with a #
+func Generate(width, height, holes int) ([]string, []string, error) {
 	if width == 0 || height == 0 || width == 1 && height == 1 {
 		return nil, nil, fmt.Errorf("Error: Requires bigger paper size")
 	}
+	if holes < 0 || holes >= width*height/2 {
+		return nil, nil, fmt.Errorf("Error: Requires bigger paper size for %d holes", holes)
+	}
 	rand.Seed(time.Now().UTC().UnixNano())
 	table := tile(width, height)
 	shuffle(table)
 	oddCorner(table)
+	cutHoles(table, holes)
 	findFlows(table)
 	return print(table)
 }
@@ -55,6 +64,11 @@ func print(table [][]int) ([]string, []string, error) {
 
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
+			if table[y][x] == HOLE_FLOW {
+				sltn[y] = sltn[y] + string(GRASS)
+				pzzl[y] = pzzl[y] + string(GRASS)
+				continue
+			}
 			sltn[y] = sltn[y] + string(SIGMA[table[y][x]])
 			if isFlowHead(x, y, table) {
 				pzzl[y] = pzzl[y] + string(SIGMA[table[y][x]])
@@ -137,21 +151,51 @@ func oddCorner(table [][]int) {
 	}
 }
 
+// Turn n random dominos into holes. After oddCorner the dominos are the
+// values of the table, though one of them may be three squares long.
+func cutHoles(table [][]int, n int) {
+	dominos := make([]int, 0)
+	seen := make(map[int]bool)
+	for _, row := range table {
+		for _, val := range row {
+			if !seen[val] {
+				seen[val] = true
+				dominos = append(dominos, val)
+			}
+		}
+	}
+	cut := make(map[int]bool)
+	for _, i := range rand.Perm(len(dominos))[:n] {
+		cut[dominos[i]] = true
+	}
+	for _, row := range table {
+		for x, val := range row {
+			if cut[val] {
+				row[x] = HOLE_FLOW
+			}
+		}
+	}
+}
+
 func findFlows(table [][]int) {
 	width, height := len(table[0]), len(table)
 	for _, p := range rand.Perm(width * height) {
 		x, y := p%width, p/width
-		if isFlowHead(x, y, table) {
+		if table[y][x] != HOLE_FLOW && isFlowHead(x, y, table) {
 			layFlow(x, y, table)
 		}
 	}
 }
 
+// Bridges, which are only found in the tables of Extract, are looked over
 func isFlowHead(x, y int, table [][]int) bool {
 	width, height := len(table[0]), len(table)
 	degree := 0
 	for i := 0; i < 4; i++ {
 		x1, y1 := x+DX[i], y+DY[i]
+		for inside(x1, y1, width, height) && table[y1][x1] == BRIDGE {
+			x1, y1 = x1+DX[i], y1+DY[i]
+		}
 		if inside(x1, y1, width, height) && table[y1][x1] == table[y][x] {
 			degree += 1
 		}
@@ -179,7 +223,7 @@ func layFlow(x, y int, table [][]int) {
 func canConnect(x1, y1, x2, y2 int, table [][]int) bool {
 	width, height := len(table[0]), len(table)
 	// Check (x1,y2) and (x2,y2) are flow heads
-	if table[y1][x1] == table[y2][x2] {
+	if table[y1][x1] == table[y2][x2] || table[y2][x2] == HOLE_FLOW {
 		return false
 	}
 	if !isFlowHead(x1, y1, table) || !isFlowHead(x2, y2, table) {
@@ -229,9 +273,9 @@ func follow(x, y, x0, y0 int, table [][]int) (int, int) {
 // * Values must be in the range [0...)
 func flatten(table [][]int) int {
 	width, height := len(table[0]), len(table)
-	// Flatten all the flows at -iota-1 so we don't
-	// accidentially merge something
-	alpha := -1
+	// Flatten all the flows at -iota-2 so we don't
+	// accidentially merge something, or a hole
+	alpha := HOLE_FLOW - 1
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
 			if table[y][x] >= 0 {
@@ -243,8 +287,10 @@ func flatten(table [][]int) int {
 	// Then invert to get what we actually wanted
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
-			table[y][x] = -table[y][x] - 1
+			if table[y][x] != HOLE_FLOW {
+				table[y][x] = HOLE_FLOW - 1 - table[y][x]
+			}
 		}
 	}
-	return -alpha - 1
+	return HOLE_FLOW - 1 - alpha
 }
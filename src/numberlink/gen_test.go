@@ -2,6 +2,7 @@ package main
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -24,3 +25,25 @@ func TestFlatten(t *testing.T) {
 		}
 	}
 }
+
+func TestGenerateHoles(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		puzzle, solution, err := Generate(6, 5, 4)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if n := strings.Count(strings.Join(puzzle, ""), string(GRASS)); n != 8 {
+			t.Errorf("Expected 8 squares of holes, got %d in %v", n, puzzle)
+		}
+		p, _ := Parse(6, 5, puzzle)
+		if err := Check(p, solution); err != nil {
+			t.Errorf("Generated solution %v doesn't solve %v: %s", solution, puzzle, err.Error())
+		}
+		if !Solve(p) {
+			t.Errorf("Expected generated puzzle %v to be solvable", puzzle)
+		}
+	}
+	if _, _, err := Generate(4, 3, 6); err == nil {
+		t.Error("Expected an error for cutting out the whole paper")
+	}
+}
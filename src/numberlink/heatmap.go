@@ -0,0 +1,94 @@
+package main
+
+import "fmt"
+
+// Which squares are the same in all the solutions of a puzzle
+type Heatmap struct {
+	// The number of solutions looked at, and whether there may be more
+	Solutions int
+	Capped    bool
+	// Set for the squares whose owner or connections differ between
+	// solutions, indexed like paper.Table
+	Ambiguous []bool
+	// The connections of the first solution found
+	first []uint8
+}
+
+// Enumerate up to limit solutions of the puzzle loaded into paper, and find
+// the squares which aren't the same in all of them. The paper is left with
+// the first solution, if there is one.
+func Ambiguity(paper *Paper, limit int) *Heatmap {
+	heat := &Heatmap{Ambiguous: make([]bool, len(paper.cells))}
+	var owner []rune
+	seen := 0
+	heat.Solutions = EachSolution(paper, func(paper *Paper) bool {
+		table := fillTable(paper)
+		if heat.first == nil {
+			owner = table
+			heat.first = make([]uint8, len(paper.cells))
+			for pos, c := range paper.cells {
+				heat.first[pos] = c.con
+			}
+		}
+		for pos, c := range paper.cells {
+			if table[pos] != owner[pos] || c.con != heat.first[pos] {
+				heat.Ambiguous[pos] = true
+			}
+		}
+		seen++
+		return seen < limit
+	})
+	heat.Capped = heat.Solutions == limit
+	for pos, con := range heat.first {
+		paper.SetCon(pos, int(con))
+	}
+	return heat
+}
+
+// The number of ambiguous squares
+func (heat *Heatmap) Count() int {
+	count := 0
+	for _, amb := range heat.Ambiguous {
+		if amb {
+			count++
+		}
+	}
+	return count
+}
+
+// Print the first solution like PrintTubes, with the ambiguous squares drawn
+// as '?', in reverse video if color is true. The paper must hold the first
+// solution, as left by Ambiguity.
+func PrintHeatmap(paper *Paper, heat *Heatmap, color bool) {
+	if heat.Solutions == 0 {
+		fmt.Println("IMPOSSIBLE")
+		return
+	}
+	if heat.Capped {
+		fmt.Printf("SOLUTIONS: at least %d\n", heat.Solutions)
+	} else {
+		fmt.Printf("SOLUTIONS: %d\n", heat.Solutions)
+	}
+	colors := makeColorTable(paper, !color)
+	for y := 1; y < paper.Height-1; y++ {
+		for x := 1; x < paper.Width-1; x++ {
+			pos := y*paper.Width + x
+			c := paper.Table[pos]
+			if c == EMPTY {
+				c = TUBE[paper.Con(pos)]
+			}
+			switch {
+			case heat.Ambiguous[pos] && color:
+				fmt.Printf("%s%s?%s", colors[pos], REVERSE, RESET)
+			case heat.Ambiguous[pos]:
+				fmt.Printf("?")
+			case color:
+				fmt.Printf("%s%c%s", colors[pos], c, RESET)
+			default:
+				fmt.Printf("%c", c)
+			}
+		}
+		fmt.Println()
+	}
+	fmt.Printf("Ambiguous: %d of %d squares\n", heat.Count(), (paper.Width-2)*(paper.Height-2))
+}
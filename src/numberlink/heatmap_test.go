@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestAmbiguity(t *testing.T) {
+	p, _ := Parse(4, 4, []string{
+		"c..b",
+		".bc.",
+		".aa.",
+		"....",
+	})
+	heat := Ambiguity(p, 10)
+	if heat.Solutions != 2 || heat.Capped {
+		t.Fatalf("Expected exactly 2 solutions, got %d", heat.Solutions)
+	}
+	// Only the a flow is the same in both
+	for y := 1; y <= 4; y++ {
+		for x := 1; x <= 4; x++ {
+			pos := y*p.Width + x
+			if heat.Ambiguous[pos] == (p.Table[pos] == 'a') {
+				t.Errorf("Expected (%d,%d) to be ambiguous: %v", x-1, y-1, !heat.Ambiguous[pos])
+			}
+		}
+	}
+	if err := Check(p, p.Letters()); err != nil {
+		t.Errorf("Expected the paper to hold a solution, got %s", err.Error())
+	}
+
+	p, _ = Parse(4, 4, []string{"c..b", ".bc.", ".aa.", "...."})
+	if heat := Ambiguity(p, 1); heat.Solutions != 1 || !heat.Capped {
+		t.Errorf("Expected to stop at 1 solution, got %d", heat.Solutions)
+	}
+	p, _ = Parse(14, 14, checkpointtest)
+	if heat := Ambiguity(p, 2); heat.Solutions != 1 || heat.Count() != 0 {
+		t.Errorf("Expected a unique solution, got %d with %d ambiguous squares", heat.Solutions, heat.Count())
+	}
+}
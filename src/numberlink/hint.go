@@ -0,0 +1,144 @@
+package main
+
+import "fmt"
+import "math/bits"
+import "strings"
+
+// A line between two neighbouring squares, from pos in direction E or S
+type Segment struct {
+	Pos, Dir int
+}
+
+// What a player drawing a puzzle would like to know
+type Hint struct {
+	// Whether the puzzle has a solution at all
+	Solvable bool
+	// Whether the drawing can still be made into a solution
+	Completable bool
+	// The segments of the drawing that aren't in any solution
+	Wrong []Segment
+	// The next line the logic solver would draw, starting from the segments
+	// which aren't wrong, or nil if it is stuck
+	Next *Deduction
+}
+
+// The segments drawn on the paper, in reading order
+func (paper *Paper) Segments() []Segment {
+	segments := make([]Segment, 0)
+	for pos := range paper.cells {
+		for _, dir := range []int{E, S} {
+			if paper.Con(pos)&dir != 0 {
+				segments = append(segments, Segment{pos, dir})
+			}
+		}
+	}
+	return segments
+}
+
+// Give a hint for drawing, which is the puzzle loaded into paper with some
+// lines drawn, as read by ParseTubes. The solver is run with the segments of
+// the drawing as drawn pieces, first all of them, and then one at a time to
+// find the wrong ones. The logic solver then continues from the rest.
+func GiveHint(paper, drawing *Paper) (*Hint, error) {
+	if paper.Width != drawing.Width || paper.Height != drawing.Height {
+		return nil, fmt.Errorf("Error: The drawing is %dx%d, expected %dx%d", drawing.Width-2, drawing.Height-2, paper.Width-2, paper.Height-2)
+	}
+	for pos := range paper.cells {
+		if paper.Table[pos] != drawing.Table[pos] {
+			return nil, fmt.Errorf("Error: The drawing doesn't have the sources of the puzzle at %s", paper.coord(pos))
+		}
+	}
+	segments := drawing.Segments()
+	hint := &Hint{Wrong: make([]Segment, 0)}
+	hint.Solvable = Solve(paper.require(nil))
+	if !hint.Solvable {
+		return hint, nil
+	}
+	hint.Completable = Solve(paper.require(segments))
+	right := segments
+	if !hint.Completable {
+		right = make([]Segment, 0)
+		for _, seg := range segments {
+			if Solve(paper.require([]Segment{seg})) {
+				right = append(right, seg)
+			} else {
+				hint.Wrong = append(hint.Wrong, seg)
+			}
+		}
+	}
+
+	// The logic solver doesn't know about bridges
+	if paper.bridges() {
+		return hint, nil
+	}
+	steps, _, err := Deduce(paper.require(right))
+	if err == nil {
+		for _, step := range steps {
+			switch step.Rule {
+			case DEDUCE_SOURCE, DEDUCE_CORNER, DEDUCE_DEAD_END, DEDUCE_TOUCH:
+				hint.Next = &step
+				return hint, nil
+			}
+		}
+	}
+	return hint, nil
+}
+
+// A copy of the puzzle loaded into paper, with the segments as drawn pieces
+// in addition to those of the puzzle
+func (paper *Paper) require(segments []Segment) *Paper {
+	w, h := paper.Width, paper.Height
+	table := make([]rune, 0, (w-2)*(h-2))
+	for y := 1; y < h-1; y++ {
+		table = append(table, paper.Table[y*w+1:(y+1)*w-1]...)
+	}
+	q := NewPaper(w-2, h-2, table)
+	for pos, c := range paper.cells {
+		q.cells[pos].fixed = c.fixed
+		if color := paper.colors[pos]; color != EMPTY {
+			q.colors[pos] = color
+			q.cells[pos].label = color
+		}
+	}
+	for _, seg := range segments {
+		q.cells[seg.Pos].fixed |= uint8(seg.Dir)
+		q.cells[seg.Pos+q.Vctr[seg.Dir]].fixed |= uint8(MIR[seg.Dir])
+	}
+	for pos := range q.cells {
+		need := 2
+		if q.isSource(pos) {
+			need = 1
+		}
+		// Bridges are connected every way anyway
+		if q.cells[pos].flag&CROSSING != 0 {
+			q.cells[pos].fixed = 0
+		}
+		if bits.OnesCount8(q.cells[pos].fixed) >= need {
+			q.cells[pos].flag |= FIXED
+		}
+	}
+	return q
+}
+
+// Print what the hint says, one thing per line
+func PrintHint(paper *Paper, hint *Hint) {
+	if !hint.Solvable {
+		fmt.Println("IMPOSSIBLE")
+		return
+	}
+	if hint.Completable {
+		fmt.Println("COMPLETABLE")
+	} else {
+		fmt.Println("NOT COMPLETABLE")
+	}
+	if len(hint.Wrong) != 0 {
+		wrong := make([]string, 0, len(hint.Wrong))
+		for _, seg := range hint.Wrong {
+			wrong = append(wrong, paper.coord(seg.Pos)+"-"+paper.coord(seg.Pos+paper.Vctr[seg.Dir]))
+		}
+		fmt.Printf("Wrong: %s\n", strings.Join(wrong, ", "))
+	}
+	if hint.Next != nil {
+		fmt.Printf("Next: %s: %s\n", DEDUCTION_NAMES[hint.Next.Rule], hint.Next.Note)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+var hintpuzzle = []string{
+	"DBECD...",
+	"........",
+	".....E..",
+	"....B...",
+	"....C...",
+	"........",
+	"........",
+	"........",
+}
+
+func TestGiveHint(t *testing.T) {
+	p, _ := Parse(8, 8, hintpuzzle)
+	d, err := ParseTubes([]string{
+		"DBECD╶─┐",
+		"╵╶╴    ╵",
+		"     E  ",
+		"    B   ",
+		"    C   ",
+		"        ",
+		"        ",
+		"        ",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	hint, err := GiveHint(p, d)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if hint.Completable || len(hint.Wrong) != 1 || hint.Wrong[0] != (Segment{2*p.Width + 2, E}) {
+		t.Errorf("Expected (1,1)-(2,1) to be wrong, got %v", hint.Wrong)
+	}
+	if hint.Next == nil || hint.Next.Note != "B at (1,0) goes to (1,1)" {
+		t.Errorf("Unexpected next step %v", hint.Next)
+	}
+
+	p, _ = Parse(8, 8, hintpuzzle)
+	d, _ = ParseTubes([]string{
+		"DBECD╶─┐",
+		"╵      ╵",
+		"     E",
+		"    B",
+		"    C",
+		" ",
+		" ",
+		" ",
+	})
+	hint, _ = GiveHint(p, d)
+	if !hint.Completable || len(hint.Wrong) != 0 || !hint.Solvable {
+		t.Errorf("Expected the drawing to be fine, got %+v", hint)
+	}
+
+	p, _ = Parse(8, 8, hintpuzzle)
+	d, _ = ParseTubes([]string{"DBECD"})
+	if _, err := GiveHint(p, d); err == nil {
+		t.Error("Expected an error for a drawing of another puzzle")
+	}
+}
@@ -0,0 +1,506 @@
+package main
+
+import "fmt"
+import "math/bits"
+import "strings"
+
+// The rules of the logic solver, roughly from the easiest to spot to the
+// hardest
+const (
+	DEDUCE_SOURCE = iota
+	DEDUCE_CORNER
+	DEDUCE_DEAD_END
+	DEDUCE_TOUCH
+	DEDUCE_SQUARE
+	DEDUCE_REACH
+	DEDUCE_CUT
+	DEDUCTIONS
+)
+
+var DEDUCTION_NAMES = [DEDUCTIONS]string{
+	DEDUCE_SOURCE:   "only one way out of a source",
+	DEDUCE_CORNER:   "corner forcing",
+	DEDUCE_DEAD_END: "dead-end avoidance",
+	DEDUCE_TOUCH:    "a flow doesn't touch itself",
+	DEDUCE_SQUARE:   "no 2x2 of one colour",
+	DEDUCE_REACH:    "only one flow reaches",
+	DEDUCE_CUT:      "bottleneck",
+}
+
+// A single step of the logic solver
+type Deduction struct {
+	Rule int
+	// The squares the step is about, the first being the one changed
+	Squares []int
+	Note    string
+}
+
+// The state of the logic solver. Lines are drawn on the paper itself, the
+// rest is kept here.
+type logic struct {
+	paper *Paper
+	// Connections known not to be used, as a set of directions per square
+	blocked []uint8
+	// Colours known without being connected to a source
+	color []rune
+	// Recomputed before each step by update
+	table []rune
+	comp  []int
+	// The squares each flow not connected yet could reach
+	reached map[rune][]bool
+}
+
+// Solve the puzzle loaded into paper the way a person would, by applying
+// the rules of DEDUCTION_NAMES until stuck, and never guessing. Lines already
+// on the paper are kept. Returns the steps taken, and whether the paper was
+// filled. An error means the puzzle, with the lines it started with, has no
+// solution. The paper is left with the lines drawn so far.
+func Deduce(paper *Paper) ([]Deduction, bool, error) {
+	return newLogic(paper).run()
+}
+
+func newLogic(paper *Paper) *logic {
+	l := &logic{
+		paper:   paper,
+		blocked: make([]uint8, len(paper.cells)),
+		color:   make([]rune, len(paper.cells)),
+	}
+	copy(l.color, paper.Table)
+	// Pieces drawn in the puzzle are lines like any other, and coloured
+	// squares are known to be their colour
+	for pos, c := range paper.cells {
+		for _, dir := range DIRS {
+			if int(c.fixed)&dir != 0 && paper.Con(pos)&dir == 0 {
+				paper.connect(pos, dir)
+			}
+		}
+		if color := paper.colors[pos]; color != EMPTY {
+			l.color[pos] = color
+		}
+	}
+	return l
+}
+
+func (l *logic) run() ([]Deduction, bool, error) {
+	paper := l.paper
+	steps := make([]Deduction, 0)
+	rules := []func() *Deduction{l.forced, l.touch, l.square, l.only, l.cut}
+	for {
+		if err := l.update(); err != nil {
+			return steps, false, err
+		}
+		if l.full() {
+			if err := Check(paper, paper.Letters()); err != nil {
+				return steps, false, fmt.Errorf("the only way to fill the paper is not a solution")
+			}
+			return steps, true, nil
+		}
+		var step *Deduction
+		for _, rule := range rules {
+			if step = rule(); step != nil {
+				break
+			}
+		}
+		if step == nil {
+			return steps, false, nil
+		}
+		steps = append(steps, *step)
+	}
+}
+
+// The square to guess at when stuck, which is the one with the fewest ways to
+// connect, and those ways
+func (l *logic) branch() (int, []int) {
+	best, dirs := -1, []int(nil)
+	for pos := range l.paper.cells {
+		if l.paper.Table[pos] == GRASS || l.missing(pos) == 0 {
+			continue
+		}
+		if options := l.options(pos); best == -1 || len(options) < len(dirs) {
+			best, dirs = pos, options
+		}
+	}
+	return best, dirs
+}
+
+// The number of connections the square must end up with
+func (l *logic) need(pos int) int {
+	if l.paper.isSource(pos) {
+		return 1
+	}
+	return 2
+}
+
+func (l *logic) missing(pos int) int {
+	return l.need(pos) - bits.OnesCount8(l.paper.cells[pos].con)
+}
+
+func (l *logic) full() bool {
+	for pos := range l.paper.cells {
+		if l.paper.Table[pos] != GRASS && l.missing(pos) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Find the parts connected by lines, and spread the known colours along them
+func (l *logic) update() error {
+	paper := l.paper
+	l.table = make([]rune, len(paper.cells))
+	l.comp = make([]int, len(paper.cells))
+	for pos := range l.comp {
+		l.comp[pos] = -1
+	}
+	for start := range paper.cells {
+		if paper.Table[start] == GRASS || l.comp[start] != -1 {
+			continue
+		}
+		part := []int{start}
+		l.comp[start] = start
+		color, lines := EMPTY, 0
+		for i := 0; i < len(part); i++ {
+			pos := part[i]
+			if c := l.color[pos]; c != EMPTY && color != EMPTY && c != color {
+				return fmt.Errorf("%c and %c are connected at %s", color, c, paper.coord(pos))
+			} else if c != EMPTY {
+				color = c
+			}
+			for _, dir := range DIRS {
+				if paper.Con(pos)&dir == 0 {
+					continue
+				}
+				lines++
+				if next := pos + paper.Vctr[dir]; l.comp[next] == -1 {
+					l.comp[next] = start
+					part = append(part, next)
+				}
+			}
+		}
+		if lines/2 >= len(part) {
+			return fmt.Errorf("there is a loop at %s", paper.coord(start))
+		}
+		for _, pos := range part {
+			l.table[pos] = color
+			if l.missing(pos) < 0 {
+				return fmt.Errorf("%s has too many connections", paper.coord(pos))
+			}
+		}
+	}
+	for pos := range paper.cells {
+		if paper.Table[pos] != GRASS && len(l.options(pos)) < l.missing(pos) {
+			return fmt.Errorf("%s can't be connected", paper.coord(pos))
+		}
+	}
+	for pos := range paper.cells {
+		for _, dir := range []int{E, S} {
+			next := pos + paper.Vctr[dir]
+			if paper.Con(pos)&dir != 0 || paper.Table[pos] == GRASS || paper.Table[next] == GRASS {
+				continue
+			}
+			if l.comp[pos] == l.comp[next] || l.table[pos] != EMPTY && l.table[pos] == l.table[next] && !l.open(pos, dir) {
+				return fmt.Errorf("a flow touches itself at %s", paper.coord(pos))
+			}
+		}
+	}
+	l.reached = make(map[rune][]bool)
+	for _, ends := range l.pairs() {
+		if !l.reaches(ends[0], ends[1], -1) {
+			return fmt.Errorf("%c can't be connected", paper.Table[ends[0]])
+		}
+		l.reached[paper.Table[ends[0]]] = l.reach(ends[0], -1)
+	}
+	for pos := range paper.cells {
+		if l.table[pos] == EMPTY && len(l.reachedBy(pos)) == 0 {
+			return fmt.Errorf("no flow can reach %s", paper.coord(pos))
+		}
+	}
+	return nil
+}
+
+// Check if a line can still be drawn from pos in direction dir
+func (l *logic) open(pos, dir int) bool {
+	next := pos + l.paper.Vctr[dir]
+	a, b := l.table[pos], l.table[next]
+	return l.paper.Con(pos)&dir == 0 && l.blocked[pos]&uint8(dir) == 0 &&
+		l.paper.Table[next] != GRASS && l.missing(pos) > 0 && l.missing(next) > 0 &&
+		l.comp[pos] != l.comp[next] && (a == EMPTY || b == EMPTY || a == b) &&
+		!l.touches(pos, next) && !l.touches(next, pos)
+}
+
+// Check if connecting pos to next would make the flow touch itself at next.
+// That is if next has another neighbour in the part of pos, or of the same
+// colour, which it can't be connected to as well.
+func (l *logic) touches(pos, next int) bool {
+	paper := l.paper
+	color := l.table[pos]
+	if color == EMPTY {
+		color = l.table[next]
+	}
+	for _, dir := range DIRS {
+		r := next + paper.Vctr[dir]
+		if r == pos || paper.Table[r] == GRASS || l.comp[r] == l.comp[next] {
+			continue
+		}
+		if l.comp[r] == l.comp[pos] {
+			return true
+		}
+		if color != EMPTY && l.table[r] == color && (l.missing(r) == 0 || l.missing(next) < 2 || l.blocked[next]&uint8(dir) != 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// The directions a line can still be drawn in from pos
+func (l *logic) options(pos int) []int {
+	dirs := make([]int, 0, 4)
+	for _, dir := range DIRS {
+		if l.open(pos, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+func (l *logic) block(pos, dir int) {
+	l.blocked[pos] |= uint8(dir)
+	l.blocked[pos+l.paper.Vctr[dir]] |= uint8(MIR[dir])
+}
+
+// A square with exactly as many ways to connect as it needs must use them
+// all. For a source that is the only way out, for an empty corner it is
+// both its neighbours, and anywhere else it avoids a dead end.
+func (l *logic) forced() *Deduction {
+	paper := l.paper
+	for pos := range paper.cells {
+		if paper.Table[pos] == GRASS || l.missing(pos) == 0 {
+			continue
+		}
+		dirs := l.options(pos)
+		if len(dirs) != l.missing(pos) {
+			continue
+		}
+		step := &Deduction{Rule: DEDUCE_DEAD_END, Squares: []int{pos}}
+		to := make([]string, 0, 2)
+		for _, dir := range dirs {
+			paper.connect(pos, dir)
+			step.Squares = append(step.Squares, pos+paper.Vctr[dir])
+			to = append(to, paper.coord(pos+paper.Vctr[dir]))
+		}
+		grass := 0
+		for _, dir := range DIRS {
+			if paper.Table[pos+paper.Vctr[dir]] == GRASS {
+				grass++
+			}
+		}
+		switch {
+		case paper.isSource(pos):
+			step.Rule = DEDUCE_SOURCE
+			step.Note = fmt.Sprintf("%c at %s goes to %s", paper.Table[pos], paper.coord(pos), to[0])
+			return step
+		case grass == 2 && len(dirs) == 2:
+			step.Rule = DEDUCE_CORNER
+		}
+		step.Note = fmt.Sprintf("%s connects to %s", paper.coord(pos), strings.Join(to, " and "))
+		return step
+	}
+	return nil
+}
+
+// Neighbours of the same colour must be connected, or the flow would touch
+// itself
+func (l *logic) touch() *Deduction {
+	paper := l.paper
+	for pos := range paper.cells {
+		for _, dir := range []int{E, S} {
+			next := pos + paper.Vctr[dir]
+			c := l.table[pos]
+			if paper.Table[pos] == GRASS || c == EMPTY || c != l.table[next] || paper.Con(pos)&dir != 0 {
+				continue
+			}
+			paper.connect(pos, dir)
+			return &Deduction{DEDUCE_TOUCH, []int{pos, next}, fmt.Sprintf("%s connects to %s, as both are %c", paper.coord(pos), paper.coord(next), c)}
+		}
+	}
+	return nil
+}
+
+// A flow never fills a 2x2 square, as it would touch itself. So if three
+// squares of one are the same colour, the fourth can't join them.
+func (l *logic) square() *Deduction {
+	paper := l.paper
+	for pos := range paper.cells {
+		block := []int{pos, pos + 1, pos + paper.Width + 1, pos + paper.Width}
+		if pos+paper.Width+1 >= len(paper.cells) || paper.Table[block[0]] == GRASS || paper.Table[block[2]] == GRASS {
+			continue
+		}
+		for i, odd := range block {
+			a, b, c := block[(i+1)%4], block[(i+2)%4], block[(i+3)%4]
+			color := l.table[b]
+			if color == EMPTY || l.table[a] != color || l.table[c] != color || l.table[odd] == color {
+				continue
+			}
+			// a and c are the neighbours of odd in the square
+			dirA, dirC := direction(paper, odd, a), direction(paper, odd, c)
+			if !l.open(odd, dirA) && !l.open(odd, dirC) {
+				continue
+			}
+			l.block(odd, dirA)
+			l.block(odd, dirC)
+			return &Deduction{DEDUCE_SQUARE, []int{odd, a, b, c}, fmt.Sprintf("%s can't join the %c square next to it", paper.coord(odd), color)}
+		}
+	}
+	return nil
+}
+
+// The direction from pos to its neighbour next
+func direction(paper *Paper, pos, next int) int {
+	for _, dir := range DIRS {
+		if pos+paper.Vctr[dir] == next {
+			return dir
+		}
+	}
+	return 0
+}
+
+// The flows that could reach the square at pos
+func (l *logic) reachedBy(pos int) []rune {
+	colors := make([]rune, 0)
+	for color, reached := range l.reached {
+		if reached[pos] {
+			colors = append(colors, color)
+		}
+	}
+	return colors
+}
+
+// Every square is part of some flow, so if only one flow can reach a square,
+// the square has its colour
+func (l *logic) only() *Deduction {
+	paper := l.paper
+	for pos := range paper.cells {
+		if paper.Table[pos] == GRASS || l.table[pos] != EMPTY {
+			continue
+		}
+		if colors := l.reachedBy(pos); len(colors) == 1 {
+			l.color[pos] = colors[0]
+			return &Deduction{DEDUCE_REACH, []int{pos}, fmt.Sprintf("%s can only be %c", paper.coord(pos), colors[0])}
+		}
+	}
+	return nil
+}
+
+// If a flow can only get from one end to the other through some square, the
+// square has its colour
+func (l *logic) cut() *Deduction {
+	paper := l.paper
+	for _, ends := range l.pairs() {
+		pos, end := ends[0], ends[1]
+		color := paper.Table[pos]
+		// Only the squares of any one way through can be needed
+		from := make([]int, len(paper.cells))
+		reached := l.search(pos, -1, from)
+		last := -1
+		for p := range paper.cells {
+			if reached[p] && l.comp[p] == l.comp[end] {
+				last = p
+				break
+			}
+		}
+		for p := last; l.comp[p] != l.comp[pos]; p = from[p] {
+			if l.table[p] != EMPTY || l.reaches(pos, end, p) {
+				continue
+			}
+			l.color[p] = color
+			return &Deduction{DEDUCE_CUT, []int{p, pos, end}, fmt.Sprintf("%c must pass through %s", color, paper.coord(p))}
+		}
+	}
+	return nil
+}
+
+// The sources of the flows not connected yet, as pairs in reading order
+func (l *logic) pairs() [][2]int {
+	paper := l.paper
+	first := make(map[rune]int)
+	pairs := make([][2]int, 0)
+	for pos := range paper.cells {
+		if !paper.isSource(pos) {
+			continue
+		}
+		if start, found := first[paper.Table[pos]]; !found {
+			first[paper.Table[pos]] = pos
+		} else if l.comp[start] != l.comp[pos] {
+			pairs = append(pairs, [2]int{start, pos})
+		}
+	}
+	return pairs
+}
+
+// The squares the flow from the source at pos could reach without going
+// through avoid
+func (l *logic) reach(pos, avoid int) []bool {
+	return l.search(pos, avoid, nil)
+}
+
+// Like reach, also noting in from where each square was reached from, if
+// from isn't nil
+func (l *logic) search(pos, avoid int, from []int) []bool {
+	paper := l.paper
+	color := paper.Table[pos]
+	reached := make([]bool, len(paper.cells))
+	queue := []int{}
+	for p := range paper.cells {
+		if l.comp[p] == l.comp[pos] {
+			reached[p] = true
+			queue = append(queue, p)
+		}
+	}
+	for len(queue) != 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, dir := range DIRS {
+			next := p + paper.Vctr[dir]
+			if reached[next] || next == avoid || l.table[next] != EMPTY && l.table[next] != color {
+				continue
+			}
+			if paper.Con(p)&dir != 0 || l.open(p, dir) {
+				reached[next] = true
+				queue = append(queue, next)
+				if from != nil {
+					from[next] = p
+				}
+			}
+		}
+	}
+	return reached
+}
+
+// Check if the flow from the source at pos could reach the source at end
+// without going through avoid
+func (l *logic) reaches(pos, end, avoid int) bool {
+	reached := l.reach(pos, avoid)
+	for p := range l.paper.cells {
+		if reached[p] && l.comp[p] == l.comp[end] {
+			return true
+		}
+	}
+	return false
+}
+
+// Print the steps of Deduce, one per line, followed by what it came to and
+// the lines drawn
+func PrintDeductions(paper *Paper, steps []Deduction, solved bool, err error, color bool) {
+	for i, step := range steps {
+		fmt.Printf("%d. %s: %s\n", i+1, DEDUCTION_NAMES[step.Rule], step.Note)
+	}
+	switch {
+	case err != nil:
+		fmt.Printf("IMPOSSIBLE: %s\n", err.Error())
+	case solved:
+		fmt.Println("SOLVED BY LOGIC")
+	default:
+		fmt.Printf("STUCK after %d steps\n", len(steps))
+	}
+	PrintTubes(paper, color)
+}
@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestDeduce(t *testing.T) {
+	p, _ := Parse(8, 8, []string{
+		"......ED",
+		".D......",
+		"........",
+		"E.......",
+		"G..B....",
+		"....C...",
+		"....F.CF",
+		"....G..B",
+	})
+	steps, solved, err := Deduce(p)
+	if !solved || err != nil {
+		t.Fatalf("Expected the puzzle to be solved by logic, got %v", err)
+	}
+	if err := Check(p, p.Letters()); err != nil {
+		t.Error(err.Error())
+	}
+	if len(steps) == 0 || steps[0].Rule != DEDUCE_CORNER {
+		t.Errorf("Expected to start in the corner, got %v", steps)
+	}
+
+	// Both solutions share only the a flow, so logic can't finish it
+	p, _ = Parse(4, 4, []string{
+		"c..b",
+		".bc.",
+		".aa.",
+		"....",
+	})
+	steps, solved, err = Deduce(p)
+	if solved || err != nil || len(steps) != 6 {
+		t.Errorf("Expected to get stuck after 6 steps, got %d, %v and %v", len(steps), solved, err)
+	}
+	if note := steps[1].Note; note != "a at (1,2) goes to (2,2)" {
+		t.Errorf("Unexpected step '%s'", note)
+	}
+
+	p, _ = Parse(3, 3, []string{
+		"ab.",
+		"...",
+		"ab.",
+	})
+	steps, _, err = Deduce(p)
+	if err == nil || err.Error() != "(1,1) can't be connected" {
+		t.Errorf("Expected a contradiction, got %v", err)
+	}
+	if len(steps) != 2 || steps[1].Rule != DEDUCE_CORNER {
+		t.Errorf("Expected to force the corner, got %v", steps)
+	}
+}
@@ -4,23 +4,69 @@ import "fmt"
 import "flag"
 import "io"
 import "os"
+import "os/signal"
 import "runtime/pprof"
 import "strings"
 import "strconv"
 import "bufio"
+import "time"
 
 var (
-	colorsFlag    = flag.Bool("colors", false, "Make the output more readable with colors")
-	tubesFlag     = flag.Bool("tubes", false, "Draw lines between sources")
-	callsFlag     = flag.Bool("calls", false, "Count number of recursive calls")
-	callsOnlyFlag = flag.Bool("calls-only", false, "Print only the culminative number of recursive calls")
-	profileFlag   = flag.String("profile", "", "Write profiling data to file")
-	generateFlag  = flag.String("generate", "", "Generate a puzzle of a certain size. Usage: --generate=5x5")
+	colorsFlag     = flag.Bool("colors", false, "Make the output more readable with colors")
+	tubesFlag      = flag.Bool("tubes", false, "Draw lines between sources")
+	callsFlag      = flag.Bool("calls", false, "Count number of recursive calls")
+	callsOnlyFlag  = flag.Bool("calls-only", false, "Print only the culminative number of recursive calls")
+	profileFlag    = flag.String("profile", "", "Write profiling data to file")
+	generateFlag   = flag.String("generate", "", "Generate a puzzle of a certain size. Usage: --generate=5x5")
+	holesFlag      = flag.Int("holes", 0, "Number of holes to cut out of generated puzzles, each the size of a domino")
+	wrapFlag       = flag.String("wrap", "flat", "Join the edges of the paper: 'cylinder' joins the left and right edges, 'torus' also the top and bottom")
+	backendFlag    = flag.String("backend", "sweep", "Solver to use: 'sweep' fills the paper diagonally, 'flow' routes one label at a time, 'bits' uses bitboards for papers of at most 64 squares")
+	checkpointFlag = flag.String("checkpoint", "", "Save the position of the search to file every so often, so it can be resumed")
+	intervalFlag   = flag.Duration("checkpoint-interval", time.Minute, "How often to save the position of the search")
+	resumeFlag     = flag.String("resume", "", "Resume the search saved in a checkpoint file. Puzzles before the saved one are skipped")
+	statsFlag      = flag.String("stats", "", "Count which rules prune the search, printed as a 'table' or as 'json'")
+	traceFlag      = flag.String("trace", "", "Write every decision of the search to file, as lines of JSON")
+	replayFlag     = flag.String("replay", "", "Show the board from a trace file at the step given by -step")
+	stepFlag       = flag.Int("step", 0, "The step of the trace to show with -replay. 0 shows the last step")
+	animateFlag    = flag.Bool("animate", false, "Draw the search in the terminal as it goes")
+	fpsFlag        = flag.Float64("fps", 20, "Frames per second of the animation. 0 draws as fast as possible")
+	skipFlag       = flag.Int("skip", 1, "Only draw every n'th step of the animation")
+	explainFlag    = flag.Bool("explain", false, "Explain why impossible puzzles can't be solved")
+	progressFlag   = flag.Duration("progress", 0, "Report the progress of the search on stderr this often. Ctrl-C then prints the deepest partial fill seen by the periodic checks")
+	checkFlag      = flag.Bool("check", false, "Read pairs of a puzzle and a claimed solution, and check the solutions")
+	fromTubesFlag  = flag.Bool("from-tubes", false, "Read solutions in the format of -tubes, and print them in the simple format, or again with -tubes")
+	extractFlag    = flag.Bool("extract", false, "Read solutions in the simple format, and print the puzzles they solve")
+	uniqueFlag     = flag.Bool("unique", false, "With -extract, check that each puzzle has a unique solution")
+	diffFlag       = flag.Bool("diff", false, "Read two solutions of the same puzzle, and show where they differ")
+	heatmapFlag    = flag.Int("heatmap", 0, "Enumerate up to n solutions of each puzzle, and mark the squares that aren't the same in all of them")
+	repairFlag     = flag.Int("repair", 0, "Propose up to n single edits that each make a puzzle with several solutions unique")
+	logicFlag      = flag.Bool("logic", false, "Solve by logic alone, printing each step, and stop when stuck")
+	rateFlag       = flag.Bool("rate", false, "Rate how hard each puzzle is for a person, from 0 to 10")
+	hintFlag       = flag.Bool("hint", false, "Read pairs of a puzzle and a partial drawing in the format of -tubes, and give a hint for each")
+	partialFlag    = flag.Bool("partial", false, "For puzzles that can't be solved, print the state with the most pairs connected")
+	budgetFlag     = flag.Duration("budget", 0, "Give up each puzzle after this long, printing the state with the most pairs connected. Implies -partial")
 )
 
+var backends = map[string]func(*Paper) bool{
+	"sweep": Solve,
+	"flow":  SolveFlows,
+	"bits":  SolveBits,
+}
+
 func main() {
 	flag.Parse()
 
+	wrap, found := TOPOLOGIES[*wrapFlag]
+	if !found {
+		fmt.Fprintf(os.Stderr, "Error: Unknown topology '%s'\n", *wrapFlag)
+		os.Exit(1)
+	}
+	if wrap != FLAT && (*generateFlag != "" || *replayFlag != "" || *hintFlag || *extractFlag || *diffFlag || *fromTubesFlag || *explainFlag || *logicFlag ||
+		*checkpointFlag != "" || *resumeFlag != "" || *heatmapFlag != 0 || *repairFlag != 0 || *rateFlag) {
+		fmt.Fprintf(os.Stderr, "Error: Wrapped papers can only be solved and checked\n")
+		os.Exit(1)
+	}
+
 	// Generating
 	if *generateFlag != "" {
 		size := strings.Split(*generateFlag, "x")
@@ -34,7 +80,7 @@ func main() {
 			fmt.Fprintf(os.Stderr, "Error: Unable to parse arguments to --generate\n")
 			os.Exit(1)
 		}
-		pzzl, _, err := Generate(width, height)
+		pzzl, _, err := Generate(width, height, *holesFlag)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
 			os.Exit(1)
@@ -47,11 +93,194 @@ func main() {
 		return
 	}
 
+	// Replaying a trace
+	if *replayFlag != "" {
+		f, err := os.Open(*replayFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		defer f.Close()
+		p, event, err := ReplayTrace(f, *stepFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		fmt.Println(event)
+		PrintTubes(p, *colorsFlag)
+		return
+	}
+
+	// Checking solutions
+	if *checkFlag {
+		if !checkAll(bufio.NewReader(os.Stdin), wrap) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Giving hints for partial drawings
+	if *hintFlag {
+		hintAll(bufio.NewReader(os.Stdin))
+		return
+	}
+
+	// Extracting puzzles from solutions
+	if *extractFlag {
+		if !extractAll(bufio.NewReader(os.Stdin), *uniqueFlag) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Comparing solutions
+	if *diffFlag {
+		reader := bufio.NewReader(os.Stdin)
+		a, err := ReadSolution(reader, 0, FLAT)
+		var b []string
+		if err == nil {
+			b, err = ReadSolution(reader, len(a), FLAT)
+		}
+		var diff *SolutionDiff
+		if err == nil {
+			diff, err = Diff(a, b)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		PrintDiff(diff, *colorsFlag)
+		return
+	}
+
+	// Converting solutions from the tubes format
+	if *fromTubesFlag {
+		reader := bufio.NewReader(os.Stdin)
+		for {
+			lines, err := ReadTubes(reader)
+			if err == io.EOF {
+				return
+			}
+			var p *Paper
+			if err == nil {
+				p, err = ParseTubes(lines)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+			if *tubesFlag {
+				PrintTubes(p, *colorsFlag)
+			} else {
+				PrintSimple(p, *colorsFlag)
+			}
+			fmt.Println()
+		}
+	}
+
+	solve, found := backends[*backendFlag]
+	if !found {
+		fmt.Fprintf(os.Stderr, "Error: Unknown backend '%s'\n", *backendFlag)
+		os.Exit(1)
+	}
+
+	if (*checkpointFlag != "" || *resumeFlag != "") && *backendFlag != "sweep" {
+		fmt.Fprintf(os.Stderr, "Error: Checkpoints are only supported by the sweep backend\n")
+		os.Exit(1)
+	}
+	if *statsFlag != "" && *statsFlag != "table" && *statsFlag != "json" {
+		fmt.Fprintf(os.Stderr, "Error: -stats must be 'table' or 'json'\n")
+		os.Exit(1)
+	}
+	if (*partialFlag || *budgetFlag != 0) && *backendFlag != "sweep" {
+		fmt.Fprintf(os.Stderr, "Error: Partial solutions are only supported by the sweep backend\n")
+		os.Exit(1)
+	}
+	if *progressFlag != 0 && *backendFlag != "sweep" {
+		fmt.Fprintf(os.Stderr, "Error: Progress reports are only supported by the sweep backend\n")
+		os.Exit(1)
+	}
+	if *heatmapFlag != 0 && *backendFlag != "sweep" {
+		fmt.Fprintf(os.Stderr, "Error: Heatmaps are only supported by the sweep backend\n")
+		os.Exit(1)
+	}
+	if *rateFlag && *backendFlag != "sweep" {
+		fmt.Fprintf(os.Stderr, "Error: Ratings are only supported by the sweep backend\n")
+		os.Exit(1)
+	}
+	if *repairFlag != 0 && *backendFlag != "sweep" {
+		fmt.Fprintf(os.Stderr, "Error: Repairs are only supported by the sweep backend\n")
+		os.Exit(1)
+	}
+	if *animateFlag && *backendFlag != "sweep" {
+		fmt.Fprintf(os.Stderr, "Error: Animation is only supported by the sweep backend\n")
+		os.Exit(1)
+	}
+	if *traceFlag != "" && *backendFlag != "sweep" {
+		fmt.Fprintf(os.Stderr, "Error: Tracing is only supported by the sweep backend\n")
+		os.Exit(1)
+	}
+	if *statsFlag != "" && *backendFlag != "sweep" {
+		fmt.Fprintf(os.Stderr, "Error: Statistics are only supported by the sweep backend\n")
+		os.Exit(1)
+	}
+	var resume *Checkpoint
+	if *resumeFlag != "" {
+		var err error
+		if resume, err = LoadCheckpoint(*resumeFlag); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	var tracer *Tracer
+	if *traceFlag != "" {
+		f, err := os.Create(*traceFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		defer f.Close()
+		tracer = NewTracer(f)
+		defer tracer.Flush()
+	}
+
+	var animator *Animator
+	if *animateFlag {
+		animator = NewAnimator(os.Stdout, *fpsFlag, *skipFlag)
+	}
+
+	var progress *Progress
+	if *progressFlag != 0 {
+		progress = NewProgress(os.Stderr, *progressFlag)
+	}
+	var partial *Partial
+	if *partialFlag || *budgetFlag != 0 {
+		partial = NewPartial(*budgetFlag)
+	}
+	// Ctrl-C is only caught while searching, and only once, so a second one
+	// still stops the program
+	var interrupts chan os.Signal
+	if progress != nil || partial != nil {
+		interrupts = make(chan os.Signal, 1)
+		go func() {
+			for range interrupts {
+				signal.Stop(interrupts)
+				if progress != nil {
+					progress.Interrupt()
+				}
+				if partial != nil {
+					partial.Interrupt()
+				}
+			}
+		}()
+	}
+
 	// Profiling
 	if *profileFlag != "" {
 		f, err := os.Create(*profileFlag)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, err.Error())
+			fmt.Fprintln(os.Stderr, err.Error())
 			os.Exit(1)
 		}
 		pprof.StartCPUProfile(f)
@@ -60,57 +289,126 @@ func main() {
 
 	// Normal run
 	reader := bufio.NewReader(os.Stdin)
-	for {
-		line, err := reader.ReadString('\n')
+	solver := new(Solver)
+	for puzzle := 0; ; puzzle++ {
+		w, h, lines, err := ReadPuzzle(reader)
 		if err != nil {
 			if err != io.EOF {
 				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
 			}
 			break
 		}
-		line = strings.TrimSpace(line)
-		if line == "" || line[0] == '#' {
+		// The results of these were printed before the checkpoint
+		if resume != nil && puzzle < resume.Puzzle {
 			continue
 		}
-		parts := strings.Split(line, " ")
-		bad := len(parts) != 2
-		var w, h int
-		if !bad {
-			var err1, err2 error
-			w, err1 = strconv.Atoi(parts[0])
-			h, err2 = strconv.Atoi(parts[1])
-			bad = bad || err1 != nil || err2 != nil
+
+		// Done parsing stuff, time for the fun part
+		p, err := solver.Parse(w, h, lines)
+		if err == nil {
+			err = p.SetWrap(wrap)
 		}
-		if bad {
-			fmt.Fprintf(os.Stderr, "Error: Expected 'width height' got '%s'\n", line)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
 			os.Exit(1)
 		}
-
-		// We use 0 0 as an end of puzzles mark
-		if w == 0 && h == 0 {
-			break
+		if *backendFlag != "sweep" && p.constrained() {
+			fmt.Fprintf(os.Stderr, "Error: Drawn pieces and coloured squares are only supported by the sweep backend\n")
+			os.Exit(1)
 		}
-		lines := make([]string, 0, w*h)
-		for i := 0; i < h; i++ {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				if err != io.EOF {
-					fmt.Fprintln(os.Stderr, err.Error())
-				}
+		if *repairFlag != 0 && p.constrained() {
+			fmt.Fprintf(os.Stderr, "Error: Drawn pieces and coloured squares are not supported by -repair\n")
+			os.Exit(1)
+		}
+		if p.bridges() && (*backendFlag == "flow" || *explainFlag || *logicFlag || *rateFlag) {
+			fmt.Fprintf(os.Stderr, "Error: Bridges are not supported by the flow backend, -explain, -logic or -rate\n")
+			os.Exit(1)
+		}
+		p.tickers = p.tickers[:0]
+		if *checkpointFlag != "" {
+			p.tickers = append(p.tickers, Checkpointer(*checkpointFlag, puzzle, *intervalFlag))
+		}
+		p.stats = nil
+		if *statsFlag != "" {
+			p.CollectStats()
+		}
+		p.trace = nil
+		if tracer != nil {
+			tracer.Start(p)
+		}
+		p.animate = nil
+		if animator != nil {
+			animator.Start(p)
+		}
+		p.progress = nil
+		if progress != nil {
+			progress.Start(p)
+		}
+		p.partial = nil
+		if partial != nil {
+			partial.Start(p)
+		}
+		if resume != nil && puzzle == resume.Puzzle {
+			if err := p.Resume(resume); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
 				os.Exit(1)
 			}
-			line = strings.TrimSpace(line)
-			lines = append(lines, line)
 		}
 
-		// Done parsing stuff, time for the fun part
-		p, err := Parse(w, h, lines)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err.Error())
-			os.Exit(1)
+		if *rateFlag {
+			if rating, ok := Rate(p); ok {
+				PrintRating(rating)
+			} else {
+				fmt.Println("IMPOSSIBLE")
+			}
+			fmt.Println()
+			continue
+		}
+		if *logicFlag {
+			steps, solved, err := Deduce(p)
+			PrintDeductions(p, steps, solved, err, *colorsFlag)
+			fmt.Println()
+			continue
+		}
+		if *repairFlag != 0 {
+			repairs, solutions := Repairs(p, *repairFlag)
+			PrintRepairs(p, repairs, solutions)
+			fmt.Println()
+			continue
+		}
+		if *heatmapFlag != 0 {
+			PrintHeatmap(p, Ambiguity(p, *heatmapFlag), *colorsFlag)
+			fmt.Println()
+			continue
 		}
 
-		res := Solve(p)
+		if interrupts != nil {
+			signal.Notify(interrupts, os.Interrupt)
+		}
+		// Don't bother searching if the puzzle is clearly impossible, unless
+		// we want to know how close we can get
+		problems := Analyze(p)
+		res := (partial != nil || len(problems) == 0) && solve(p)
+		if interrupts != nil {
+			signal.Stop(interrupts)
+		}
+		if animator != nil {
+			animator.Finish(p)
+		}
+		if p.err != nil {
+			fmt.Fprintln(os.Stderr, p.err.Error())
+			os.Exit(1)
+		}
+		if progress != nil && progress.Interrupted && partial == nil {
+			progress.Best(p)
+			fmt.Printf("INTERRUPTED at %.1f%%\n", progress.BestPercent())
+			PrintTubes(p, *colorsFlag)
+			if tracer != nil {
+				tracer.Flush()
+			}
+			os.Exit(130)
+		}
 		if !*callsOnlyFlag {
 			if res {
 				switch {
@@ -119,18 +417,146 @@ func main() {
 				default:
 					PrintSimple(p, *colorsFlag)
 				}
+			} else if partial != nil {
+				partial.Restore(p)
+				PrintPartial(p, *colorsFlag)
+			} else if *explainFlag {
+				PrintDiagnosis(p, Explain(p), *colorsFlag)
 			} else {
 				fmt.Println("IMPOSSIBLE")
+				for _, problem := range problems {
+					fmt.Printf("# %s\n", problem)
+				}
 			}
 
 			if *callsFlag {
 				fmt.Printf("Called %d times\n", Calls)
 				Calls = 0
 			}
+			switch *statsFlag {
+			case "table":
+				p.stats.PrintTable(os.Stdout)
+			case "json":
+				p.stats.PrintJSON(os.Stdout)
+			}
 			fmt.Println()
 		}
 	}
 	if *callsOnlyFlag {
 		fmt.Printf("Called %d times\n", Calls)
 	}
+	// Everything was solved, so there is nothing left to resume
+	if *checkpointFlag != "" {
+		os.Remove(*checkpointFlag)
+	}
+}
+
+// Check each puzzle of the input against the solution following it, which
+// may be in either the simple or the tubes format, and print OK or the first
+// problem of each. The papers are wrapped as given by wrap. Returns false if
+// any were wrong.
+func checkAll(reader *bufio.Reader, wrap int) bool {
+	good := true
+	for {
+		w, h, lines, err := ReadPuzzle(reader)
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+			return good
+		}
+		solution, err := ReadSolution(reader, h, wrap)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		p, err := Parse(w, h, lines)
+		if err == nil {
+			err = p.SetWrap(wrap)
+		}
+		if err == nil {
+			err = Check(p, solution)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			good = false
+		} else {
+			fmt.Println("OK")
+		}
+	}
+}
+
+// Give a hint for each puzzle of the input, and the drawing following it
+func hintAll(reader *bufio.Reader) {
+	for {
+		w, h, lines, err := ReadPuzzle(reader)
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+			return
+		}
+		drawing, err := ReadTubes(reader)
+		var p, d *Paper
+		if err == nil {
+			p, err = Parse(w, h, lines)
+		}
+		if err == nil {
+			d, err = ParseTubes(drawing)
+		}
+		var hint *Hint
+		if err == nil {
+			hint, err = GiveHint(p, d)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		PrintHint(p, hint)
+		fmt.Println()
+	}
+}
+
+// Print the puzzle solved by each solution of the input. If unique is true,
+// each puzzle is preceded by a comment saying if its solution is unique.
+// Returns false if any of the solutions were bad, or if unique is true and
+// some puzzle has more than one solution.
+func extractAll(reader *bufio.Reader, unique bool) bool {
+	good := true
+	for {
+		w, h, solution, err := ReadPuzzle(reader)
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+			return good
+		}
+		puzzle, err := Extract(solution)
+		var p *Paper
+		if err == nil {
+			p, err = Parse(w, h, puzzle)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			fmt.Println()
+			good = false
+			continue
+		}
+		if unique {
+			if CountSolutions(p, 2) == 1 {
+				fmt.Println("# Unique")
+			} else {
+				fmt.Println("# Not unique")
+				good = false
+			}
+		}
+		fmt.Println(w, h)
+		for _, line := range puzzle {
+			fmt.Println(line)
+		}
+		fmt.Println()
+	}
 }
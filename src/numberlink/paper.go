@@ -3,6 +3,8 @@ package main
 const (
 	GRASS = '#'
 	EMPTY = '.'
+	// A square where a horizontal and a vertical flow cross
+	BRIDGE = '┼'
 )
 
 const (
@@ -21,6 +23,44 @@ var (
 	DIAG = [16]bool{N | E: true, N | W: true, S | E: true, S | W: true}
 )
 
+// Flags for the fixed properties of a square
+const (
+	SOURCE = 1 << iota
+	CAN_SE
+	CAN_SW
+	BLOCKED
+	// All the connections of the square are given by fixed
+	FIXED
+	// Grass inside the paper, which flows may turn around
+	HOLE
+	// The square is a bridge
+	CROSSING
+	// The square is next to a bridge, or is one, so the rules about corners
+	// don't hold
+	NEAR
+)
+
+// Everything the solver needs to know about a square. Keeping it together in
+// 16 bytes, rather than in a table for each field, means the search touches
+// a single cache line per square, which matters on very large papers.
+type cell struct {
+	// The connections of the square, as a set of directions
+	con uint8
+	// SOURCE, CAN_SE, CAN_SW, BLOCKED, FIXED, HOLE, CROSSING and NEAR
+	flag uint8
+	// Which of the (at most two) ways to connect the square is being tried
+	branch uint8
+	// Connections the square must have, drawn in the puzzle
+	fixed uint8
+	// If the square is a link head, the position of the other end
+	end int32
+	// The square visited after this one in the diagonal order
+	next int32
+	// The value in Table, kept here for fast comparisons of link ends. For
+	// the ends of a link through a coloured square, it is that colour.
+	label int32
+}
+
 type Paper struct {
 	Width  int
 	Height int
@@ -29,23 +69,64 @@ type Paper struct {
 	Crnr [16]int
 
 	Table []int32
-	Con   []int
-
-	source []bool
-	end    []int
-	canSE  []bool
-	canSW  []bool
-
-	next []int
+	// The edges joined to the opposite edge, see SetWrap
+	Wrap int
+
+	cells []cell
+	// The cells, followed by the vertical halves of the bridges if there
+	// are any. The flows crossing a bridge are links of their own, so the
+	// vertical half of the bridge at pos is a link end at pos+len(cells).
+	links []cell
+	// Scratch table for validate
+	vtable []rune
+	// The colour each square is marked with in the puzzle, or EMPTY. The
+	// search keeps the colours of its links in the labels of the cells.
+	colors []rune
+
+	// Functions called every TICK_MASK+1 calls during the search
+	tickers []func(paper *Paper, pos int)
+	// If not nil, counts which rules prune the search where
+	stats *Stats
+	// If not nil, every decision of the search is written here
+	trace *Tracer
+	// If not nil, the search is drawn as it goes
+	animate *Animator
+	// If not nil, follows how deep the search has been
+	progress *Progress
+	// If not nil, remembers the most complete flows found
+	partial *Partial
+	// If not nil, called with every solution found. The search goes on
+	// looking for more, unless it returns true.
+	onSolution func(paper *Paper) bool
+	// Set to make the search give up as quickly as possible
+	stop bool
+	// Why the search was stopped, if it was because of an error
+	err error
+	// When resuming a search, the branches recorded in the cells are
+	// replayed until we get back to resumeAt
+	replaying bool
+	resumeAt  int
+	resumed   *Checkpoint
 }
 
+// How often the tickers of a paper are called
+var TICK_MASK = 1<<16 - 1
+
 func NewPaper(width, height int, table []rune) *Paper {
-	paper := new(Paper)
+	return new(Paper).Load(width, height, table)
+}
 
+// Reuse the paper for a new puzzle. The tables of the paper are only
+// reallocated if they are too small, so loading many puzzles into the same
+// paper creates little garbage.
+func (paper *Paper) Load(width, height int, table []rune) *Paper {
 	// Pad the given table with #, to make boundery checks easier
 	w, h := width+2, height+2
 	paper.Width, paper.Height = w, h
-	paper.Table = make([]rune, 0, w*h)
+	if cap(paper.Table) < w*h {
+		paper.Table = make([]rune, 0, w*h)
+	}
+	paper.Table = paper.Table[:0]
 	for i := 0; i < w; i++ {
 		paper.Table = append(paper.Table, GRASS)
 	}
@@ -60,13 +141,70 @@ func NewPaper(width, height int, table []rune) *Paper {
 		paper.Table = append(paper.Table, GRASS)
 	}
 
+	paper.Wrap = FLAT
 	paper.initTables()
 
 	return paper
 }
 
+// The connections of the square at pos, as a set of directions
+func (paper *Paper) Con(pos int) int {
+	return int(paper.cells[pos].con)
+}
+
+// Replace the connections of the square at pos
+func (paper *Paper) SetCon(pos int, con int) {
+	paper.cells[pos].con = uint8(con)
+}
+
+func (paper *Paper) isSource(pos int) bool {
+	return paper.cells[pos].flag&SOURCE != 0
+}
+
+// Connect pos with its neighbour in direction dir, and the neighbour back
+func (paper *Paper) connect(pos int, dir int) {
+	paper.cells[pos].con |= uint8(dir)
+	paper.cells[paper.neighbour(pos, dir)].con |= uint8(MIR[dir])
+}
+
+// The neighbour in direction dir, looking over bridges
+func (paper *Paper) across(pos int, dir int) int {
+	next := paper.neighbour(pos, dir)
+	for paper.Table[next] == BRIDGE {
+		next = paper.neighbour(next, dir)
+	}
+	return next
+}
+
+// Undo a connect
+func (paper *Paper) disconnect(pos int, dir int) {
+	paper.cells[pos].con &^= uint8(dir)
+	paper.cells[paper.neighbour(pos, dir)].con &^= uint8(MIR[dir])
+}
+
+// Check if the puzzle has holes, that is grass inside the paper
+func (paper *Paper) holes() bool {
+	for _, c := range paper.cells {
+		if c.flag&HOLE != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if the puzzle has bridges
+func (paper *Paper) bridges() bool {
+	return len(paper.links) != len(paper.cells)
+}
+
+// The square the search starts at. Position 0 is in the grass, so its next
+// is free to point at the first square of the diagonal order.
+func (paper *Paper) first() int {
+	return int(paper.cells[0].next)
+}
+
 func Solve(paper *Paper) bool {
-	return chooseConnection(paper, paper.Crnr[N|W])
+	return chooseConnection(paper, paper.first())
 }
 
 var Calls = 0
@@ -74,81 +212,192 @@ var Calls = 0
 func chooseConnection(paper *Paper, pos int) bool {
 	Calls++
 
+	if Calls&TICK_MASK == 0 {
+		for _, tick := range paper.tickers {
+			tick(paper, pos)
+		}
+	}
+	if paper.replaying && pos == paper.resumeAt {
+		paper.finishReplay()
+	}
+	if paper.stop {
+		return false
+	}
+	if paper.stats != nil {
+		paper.stats.visit(paper, pos)
+	}
+	if paper.animate != nil {
+		paper.animate.frame(paper, pos)
+	}
+	if paper.progress != nil {
+		paper.progress.visit(paper, pos)
+	}
+
 	// Final
 	if pos == 0 {
-		return paper.validate()
+		if !paper.validate() {
+			return paper.pruned(PRUNE_VALIDATE, pos, 0)
+		}
+		if paper.trace != nil {
+			paper.trace.record(paper, "solved", pos, 0, "")
+		}
+		if paper.onSolution != nil {
+			return paper.onSolution(paper)
+		}
+		return true
 	}
 
 	w := paper.Width
-	if paper.source[pos] {
-		switch paper.Con[pos] {
+	cells := paper.cells
+	here := &cells[pos]
+	if here.flag&NEAR != 0 {
+		if paper.Wrap != FLAT {
+			return chooseAround(paper, pos)
+		}
+		return chooseNearBridge(paper, pos)
+	}
+	if here.flag&SOURCE != 0 {
+		switch here.con {
 		// If the source is not yet connection
 		case 0:
 			// We can't connect E if we have a NE corner
-			if paper.Con[pos-w+1] != S|W {
-				if tryConnection(paper, pos, E) {
+			if cells[pos-w+1].con != S|W || paper.pruned(PRUNE_NE_CORNER, pos, E) {
+				if tryBranch(paper, pos, 0, E) {
 					return true
 				}
 			}
 			// South connections can create a forced SE position
-			if checkImplicitSE(paper, pos) {
-				if tryConnection(paper, pos, S) {
+			if checkImplicitSE(paper, pos) || paper.pruned(PRUNE_IMPLICIT_SE, pos, S) {
+				if tryBranch(paper, pos, 1, S) {
 					return true
 				}
 			}
 		// If the source is already connected
 		case N, W:
-			return chooseConnection(paper, paper.next[pos])
+			if here.con&here.fixed != here.fixed {
+				return paper.pruned(PRUNE_FIXED, pos, 0)
+			}
+			return chooseConnection(paper, int(here.next))
+		// If the source is connected both N and W
+		default:
+			return paper.pruned(PRUNE_FULL_SOURCE, pos, 0)
 		}
 	} else {
-		switch paper.Con[pos] {
+		switch here.con {
 		// SE
 		case 0:
 			// Should we check for implied N|W?
-			if paper.canSE[pos] {
+			if here.flag&CAN_SE != 0 || paper.pruned(PRUNE_CAN_SE, pos, E|S) {
 				return tryConnection(paper, pos, E|S)
 			}
 		// SW or WE
 		case W:
 			// Check there is a free line down to the source we are turning around
-			if paper.canSW[pos] && checkSWLane(paper, pos) && checkImplicitSE(paper, pos) {
-				if tryConnection(paper, pos, S) {
+			if (here.flag&CAN_SW != 0 || paper.pruned(PRUNE_CAN_SW, pos, S)) &&
+				(checkSWLane(paper, pos) || paper.pruned(PRUNE_SW_LANE, pos, S)) &&
+				(checkImplicitSE(paper, pos) || paper.pruned(PRUNE_IMPLICIT_SE, pos, S)) {
+				if tryBranch(paper, pos, 0, S) {
 					return true
 				}
 			}
 			// Ensure we don't block of any diagonals (NE and NW don't seem very important)
-			if paper.Con[pos-w+1] != S|W && paper.Con[pos-w-1] != S|E {
-				return tryConnection(paper, pos, E)
+			if (cells[pos-w+1].con != S|W || paper.pruned(PRUNE_NE_CORNER, pos, E)) &&
+				(cells[pos-w-1].con != S|E || paper.pruned(PRUNE_NW_CORNER, pos, E)) {
+				return tryBranch(paper, pos, 1, E)
 			}
 		// NW
 		case N | W:
 			// Check if the 'by others implied' turn is actually allowed
 			// We don't need to check the source connection here like in N|E
-			if paper.Con[pos-w-1] == (N|W) || paper.source[pos-w-1] {
-				return chooseConnection(paper, paper.next[pos])
+			if nw := &cells[pos-w-1]; nw.con == (N|W) || nw.flag&(SOURCE|HOLE) != 0 || paper.pruned(PRUNE_NW_TURN, pos, 0) {
+				if here.fixed&^(N|W) != 0 {
+					return paper.pruned(PRUNE_FIXED, pos, 0)
+				}
+				return chooseConnection(paper, int(here.next))
 			}
 		// NE or NS
 		case N:
 			// Check that we are either extending a corner or starting at a non-occupied source
-			if paper.Con[pos-w+1] == N|E || paper.source[pos-w+1] && paper.Con[pos-w+1]&(N|E) != 0 {
-				if tryConnection(paper, pos, E) {
+			ne := &cells[pos-w+1]
+			if ne.con == N|E || ne.flag&SOURCE != 0 && ne.con&(N|E) != 0 || ne.flag&HOLE != 0 || paper.pruned(PRUNE_NE_TURN, pos, E) {
+				if tryBranch(paper, pos, 0, E) {
 					return true
 				}
 			}
 			// Ensure we don't block of any diagonals
-			if paper.Con[pos-w+1] != S|W && paper.Con[pos-w-1] != S|E && checkImplicitSE(paper, pos) {
-				return tryConnection(paper, pos, S)
+			if (ne.con != S|W || paper.pruned(PRUNE_NE_CORNER, pos, S)) &&
+				(cells[pos-w-1].con != S|E || paper.pruned(PRUNE_NW_CORNER, pos, S)) &&
+				(checkImplicitSE(paper, pos) || paper.pruned(PRUNE_IMPLICIT_SE, pos, S)) {
+				return tryBranch(paper, pos, 1, S)
 			}
 		}
 	}
 	return false
 }
 
+// Like chooseConnection, for bridges and the squares next to them. A bridge
+// must be connected N and W by now, and goes on E and S. Other squares try
+// every way to connect, as the two flows of a bridge break the rules about
+// which corners are possible.
+func chooseNearBridge(paper *Paper, pos int) bool {
+	here := &paper.cells[pos]
+	switch {
+	case here.flag&CROSSING != 0:
+		if here.con != N|W {
+			return paper.pruned(PRUNE_BRIDGE, pos, 0)
+		}
+		return tryConnection(paper, pos, E|S)
+	case here.flag&SOURCE != 0:
+		switch here.con {
+		case 0:
+			if tryBranch(paper, pos, 0, E) {
+				return true
+			}
+			return tryBranch(paper, pos, 1, S)
+		case N, W:
+			if here.con&here.fixed != here.fixed {
+				return paper.pruned(PRUNE_FIXED, pos, 0)
+			}
+			return chooseConnection(paper, int(here.next))
+		}
+		return paper.pruned(PRUNE_FULL_SOURCE, pos, 0)
+	}
+	switch here.con {
+	case 0:
+		return tryConnection(paper, pos, E|S)
+	case W:
+		if tryBranch(paper, pos, 0, S) {
+			return true
+		}
+		return tryBranch(paper, pos, 1, E)
+	case N:
+		if tryBranch(paper, pos, 0, E) {
+			return true
+		}
+		return tryBranch(paper, pos, 1, S)
+	}
+	if here.fixed&^(N|W) != 0 {
+		return paper.pruned(PRUNE_FIXED, pos, 0)
+	}
+	return chooseConnection(paper, int(here.next))
+}
+
+// Try one of the two ways to connect pos. The branch is recorded in the cell,
+// which lets us save the position of the search and later replay it.
+func tryBranch(paper *Paper, pos int, branch uint8, dirs int) bool {
+	here := &paper.cells[pos]
+	if paper.replaying && branch < here.branch {
+		return false
+	}
+	here.branch = branch
+	return tryConnection(paper, pos, dirs)
+}
+
 // Check that a SW line of corners, starting at pos, will not intersect a SE or NW line
 func checkSWLane(paper *Paper, pos int) bool {
-	for ; !paper.source[pos]; pos += paper.Width - 1 {
+	for ; paper.cells[pos].flag&(SOURCE|HOLE|NEAR) == 0; pos += paper.Width - 1 {
 		// Con = 0 means we are crossing a SE line, N|W means a NW
-		if paper.Con[pos] != W {
+		if paper.cells[pos].con != W {
 			return false
 		}
 	}
@@ -159,51 +408,98 @@ func checkSWLane(paper *Paper, pos int) bool {
 // Somethine like: │└
 //                 │   <-- Forced SE corner
 func checkImplicitSE(paper *Paper, pos int) bool {
-	return !(paper.Con[pos+1] == 0) || paper.canSE[pos+1] || paper.Table[pos+1] != EMPTY
+	east := &paper.cells[pos+1]
+	return east.con != 0 || east.flag&(CAN_SE|SOURCE|BLOCKED) != 0
 }
 
 func tryConnection(paper *Paper, pos1 int, dirs int) bool {
+	cells := paper.links
 	// Extract the (last) bit which we will process in this call
 	dir := dirs & -dirs
-	pos2 := pos1 + paper.Vctr[dir]
-	end1, end2 := paper.end[pos1], paper.end[pos2]
+	pos2 := paper.neighbour(pos1, dir)
+	// The links being joined, which are the squares themselves, except for
+	// the vertical halves of bridges
+	link1, link2 := pos1, pos2
+	if dir&(N|S) != 0 && len(cells) != len(paper.cells) {
+		if cells[pos1].flag&CROSSING != 0 {
+			link1 += len(paper.cells)
+		}
+		if cells[pos2].flag&CROSSING != 0 {
+			link2 += len(paper.cells)
+		}
+	}
+	end1, end2 := cells[link1].end, cells[link2].end
 
 	// Cannot connect out of the paper
-	if paper.Table[pos2] == GRASS {
-		return false
+	if cells[pos2].flag&BLOCKED != 0 {
+		return paper.pruned(PRUNE_GRASS, pos1, dir)
+	}
+	// Squares drawn in the puzzle only connect the way they are drawn
+	if cells[pos1].flag&FIXED != 0 && cells[pos1].fixed&uint8(dir) == 0 ||
+		cells[pos2].flag&FIXED != 0 && cells[pos2].fixed&uint8(MIR[dir]) == 0 {
+		return paper.pruned(PRUNE_FIXED, pos1, dir)
+	}
+	// On wrapped papers, squares can be connected from three sides before
+	// they are visited
+	if paper.Wrap != FLAT && paper.full(pos2) {
+		return paper.pruned(PRUNE_DEGREE, pos1, dir)
 	}
 	// Check different sources aren't connected
-	if paper.Table[end1] != EMPTY && paper.Table[end2] != EMPTY &&
-		paper.Table[end1] != paper.Table[end2] {
-		return false
+	label1, label2 := cells[end1].label, cells[end2].label
+	if label1 != EMPTY && label2 != EMPTY && label1 != label2 {
+		return paper.pruned(PRUNE_SOURCES, pos1, dir)
 	}
 	// No loops
-	if end1 == pos2 && end2 == pos1 {
-		return false
+	if int(end1) == link2 && int(end2) == link1 {
+		return paper.pruned(PRUNE_LOOP, pos1, dir)
 	}
 	// No tight corners (Just an optimization)
-	if paper.Con[pos1] != 0 {
-		dir2 := paper.Con[pos1+paper.Vctr[paper.Con[pos1]]]
-		dir3 := paper.Con[pos1] | dir
+	if con1 := cells[pos1].con; con1 != 0 && cells[pos1].flag&NEAR == 0 {
+		dir2 := int(cells[pos1+paper.Vctr[con1]].con)
+		dir3 := int(con1) | dir
 		if DIAG[dir2] && DIAG[dir3] && dir2&dir3 != 0 {
-			return false
+			return paper.pruned(PRUNE_TIGHT_CORNER, pos1, dir)
 		}
 	}
 
 	// Add the connection and a backwards connection from pos2
-	old1, old2 := paper.Con[pos1], paper.Con[pos2]
-	paper.Con[pos1] |= dir
-	paper.Con[pos2] |= MIR[dir]
+	old1, old2 := cells[pos1].con, cells[pos2].con
+	cells[pos1].con |= uint8(dir)
+	cells[pos2].con |= uint8(MIR[dir])
 	// Change states of ends to connect pos1 and pos2
-	old3, old4 := paper.end[end1], paper.end[end2]
-	paper.end[end1] = end2
-	paper.end[end2] = end1
+	old3, old4 := cells[end1].end, cells[end2].end
+	cells[end1].end = end2
+	cells[end2].end = end1
+	// The colour of either link now belongs to both ends
+	old5, old6 := cells[end1].label, cells[end2].label
+	if label1 == EMPTY {
+		cells[end1].label = label2
+	} else {
+		cells[end2].label = label1
+	}
+	if paper.trace != nil {
+		paper.trace.record(paper, "accept", pos1, dir, "")
+	}
+	// Both ends being sources means we just completed a flow
+	completed := cells[end1].flag&SOURCE != 0 && cells[end2].flag&SOURCE != 0
+	if completed && paper.partial != nil {
+		paper.partial.complete(paper, int(end1), 1)
+	}
 
 	// Remove the done bit and recurse if nessecary
 	dir2 := dirs &^ dir
 	res := false
-	if dir2 == 0 {
-		res = chooseConnection(paper, paper.next[pos1])
+	if completed && paper.Wrap != FLAT && paper.touchesItself(int(end1)) {
+		res = paper.pruned(PRUNE_TOUCHING, pos1, dir)
+	} else if dir2 == 0 {
+		// The square is done, so it must have all its drawn connections
+		if cells[pos1].con&cells[pos1].fixed != cells[pos1].fixed {
+			res = paper.pruned(PRUNE_FIXED, pos1, 0)
+		} else if paper.Wrap != FLAT && paper.touchesAround(pos1) {
+			res = paper.pruned(PRUNE_TOUCHING, pos1, 0)
+		} else {
+			res = chooseConnection(paper, int(cells[pos1].next))
+		}
 	} else {
 		res = tryConnection(paper, pos1, dir2)
 	}
@@ -211,10 +507,18 @@ func tryConnection(paper *Paper, pos1 int, dirs int) bool {
 	// Recreate the state, but not if a solution was found,
 	// since we'll let it bubble all the way to the caller
 	if !res {
-		paper.Con[pos1] = old1
-		paper.Con[pos2] = old2
-		paper.end[end1] = old3
-		paper.end[end2] = old4
+		cells[pos1].con = old1
+		cells[pos2].con = old2
+		cells[end1].end = old3
+		cells[end2].end = old4
+		cells[end1].label = old5
+		cells[end2].label = old6
+		if paper.trace != nil {
+			paper.trace.record(paper, "undo", pos1, dir, "")
+		}
+		if completed && paper.partial != nil {
+			paper.partial.complete(paper, int(end1), -1)
+		}
 	}
 
 	return res
@@ -225,18 +529,32 @@ func tryConnection(paper *Paper, pos1 int, dirs int) bool {
 // the false positives
 func (paper *Paper) validate() bool {
 	w, h := paper.Width, paper.Height
-	vtable := make([]rune, w*h)
+	vtable := paper.vtable
+	for pos := range vtable {
+		vtable[pos] = 0
+	}
 	for pos := 0; pos < w*h; pos++ {
-		if paper.source[pos] {
+		// Each flow is run through once, from the source found first
+		if paper.isSource(pos) && vtable[pos] != paper.Table[pos] {
 			// Run throw the flow
 			alpha := paper.Table[pos]
 			p, old, next := pos, pos, pos
 			for {
+				// Flows go straight over bridges, and can't cross
+				// themselves
+				if paper.cells[p].flag&CROSSING != 0 {
+					if vtable[p] == alpha {
+						return false
+					}
+					vtable[p] = alpha
+					old, p = p, 2*p-old
+					continue
+				}
 				// Mark our path as we go
 				vtable[p] = alpha
 				for _, dir := range DIRS {
-					cand := p + paper.Vctr[dir]
-					if paper.Con[p]&dir != 0 {
+					cand := paper.neighbour(p, dir)
+					if paper.Con(p)&dir != 0 {
 						if cand != old {
 							next = cand
 						}
@@ -247,7 +565,7 @@ func (paper *Paper) validate() bool {
 					}
 				}
 				// We have reached the end
-				if old != p && paper.source[p] {
+				if old != p && paper.isSource(p) {
 					break
 				}
 				old, p = p, next
@@ -262,6 +580,7 @@ func (paper *Paper) initTables() {
 
 	// Direction vector table
 	for dir := 0; dir < 16; dir++ {
+		paper.Vctr[dir] = 0
 		if dir&N != 0 {
 			paper.Vctr[dir] += -w
 		}
@@ -282,57 +601,91 @@ func (paper *Paper) initTables() {
 	paper.Crnr[S|E] = h*w - w - 2
 	paper.Crnr[S|W] = h*w - 2*w + 1
 
-	// Table to easily check if a position is a source
-	paper.source = make([]bool, w*h)
-	for pos := 0; pos < w*h; pos++ {
-		paper.source[pos] = paper.Table[pos] != EMPTY && paper.Table[pos] != GRASS
+	// Fixed properties of the squares, and 'where is the other end' table.
+	// Bridges need room for their vertical halves after the squares.
+	links := w * h
+	for _, c := range paper.Table {
+		if c == BRIDGE {
+			links = 2 * w * h
+			break
+		}
+	}
+	if cap(paper.links) < links {
+		paper.links = make([]cell, links)
+	}
+	if cap(paper.vtable) < w*h {
+		paper.vtable = make([]rune, w*h)
+		paper.colors = make([]rune, w*h)
+	}
+	paper.links = paper.links[:links]
+	paper.cells = paper.links[:w*h]
+	paper.vtable = paper.vtable[:w*h]
+	paper.colors = paper.colors[:w*h]
+	paper.stop, paper.err = false, nil
+	paper.replaying, paper.resumed = false, nil
+	for pos := range paper.links {
+		c := &paper.links[pos]
+		*c = cell{}
+		c.end = int32(pos)
+		if pos >= w*h {
+			c.label = EMPTY
+			continue
+		}
+		c.label = paper.Table[pos]
+		paper.colors[pos] = EMPTY
+		if x, y := pos%w, pos/w; paper.Table[pos] == GRASS {
+			c.flag |= BLOCKED
+			if 0 < x && x < w-1 && 0 < y && y < h-1 {
+				c.flag |= HOLE
+			}
+		} else if paper.Table[pos] == BRIDGE {
+			c.flag |= CROSSING
+			c.label = EMPTY
+		} else if paper.Table[pos] != EMPTY {
+			c.flag |= SOURCE
+		}
+	}
+	// Next to bridges, any corner is allowed
+	for pos := range paper.Table {
+		if paper.Table[pos] == BRIDGE {
+			for _, d := range []int{-w - 1, -w, -w + 1, -1, 0, 1, w - 1, w, w + 1} {
+				if paper.Table[pos+d] != GRASS {
+					paper.cells[pos+d].flag |= NEAR | CAN_SE | CAN_SW
+				}
+			}
+		}
 	}
 
-	// Pivot tables
-	paper.canSE = make([]bool, w*h)
-	paper.canSW = make([]bool, w*h)
+	// Pivot tables. Flows turn around sources, holes and bridges.
 	for pos := range paper.Table {
-		if paper.source[pos] {
+		if paper.cells[pos].flag&(SOURCE|HOLE|NEAR) != 0 {
 			d := paper.Vctr[N|W]
 			for p := pos + d; paper.Table[p] == EMPTY; p += d {
-				paper.canSE[p] = true
+				paper.cells[p].flag |= CAN_SE
 			}
 			d = paper.Vctr[N|E]
 			for p := pos + d; paper.Table[p] == EMPTY; p += d {
-				paper.canSW[p] = true
+				paper.cells[p].flag |= CAN_SW
 			}
 		}
 	}
 
 	// Diagonal 'next' table
-	paper.next = make([]int, w*h)
+	// The diagonals start along the top row, and then down the right side.
+	// Holes are skipped, so the last square is not always the corner.
 	last := 0
-	for _, pos := range append(
-		xrange(paper.Crnr[N|W], paper.Crnr[N|E], 1),
-		xrange(paper.Crnr[N|E], paper.Crnr[S|E]+1, w)...) {
-		for paper.Table[pos] != GRASS {
-			paper.next[last] = pos
+	for start := paper.Crnr[N|W]; start <= paper.Crnr[S|E]; {
+		for pos := start; pos%w != 0 && pos < (h-1)*w; pos = pos + w - 1 {
+			if paper.Table[pos] == GRASS {
+				continue
+			}
+			paper.cells[last].next = int32(pos)
 			last = pos
-			pos = pos + w - 1
+		}
+		if start < paper.Crnr[N|E] {
+			start++
+		} else {
+			start += w
 		}
 	}
-
-	// 'Where is the other end' table
-	paper.end = make([]int, w*h)
-	for pos := 0; pos < w*h; pos++ {
-		paper.end[pos] = pos
-	}
-
-	// Connection table
-	paper.Con = make([]int, w*h)
-}
-
-// Makes a slice of the interval [i, i+step, i+2step, ..., j)
-func xrange(i int, j int, step int) []int {
-	slice := make([]int, 0, (j-i+step-1)/step)
-	for i < j {
-		slice = append(slice, i)
-		i += step
-	}
-	return slice
 }
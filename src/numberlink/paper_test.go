@@ -1,5 +1,9 @@
 package main
 
+import "bufio"
+import "io"
+import "os"
+import "strings"
 import "testing"
 
 var papertests = []struct {
@@ -22,10 +26,20 @@ var papertests = []struct {
 	{4, 5, 2, 44},
 	{4, 6, 2, 44},
 	{5, 5, 2, 48},
-/*	{6, 6, 2, 72},
+}
+
+// These are only feasible with the BitSolver
+var bigpapertests = []struct {
+	width int
+	height int
+	n int
+	out int
+}{
+	{6, 6, 2, 72},
 	{7, 7, 2, 96},
 	{8, 8, 2, 96},
-	{9, 9, 2, 144},
+	// Too large to fit in a bitboard
+/*	{9, 9, 2, 144},
 	{10, 10, 2, 240},*/
 }
 
@@ -36,44 +50,190 @@ func TestSolve(t *testing.T) {
 			continue
 		}
 
-		al := choose2(tt.width*tt.height)
-		bl := choose2(tt.width*tt.height-2)
-		count := 0
-		as := []int{0,1}
-		for i := 0; i < al; i++ {
-			bs := []int{0,1}
-			for j := 0; j < bl; j++ {
-				a1, a2 := as[0], as[1]
-				b1, b2 := bs[0], bs[1]
-				if a1 <= b1 {
-					b1++
-				}
-				if a2 <= b1 {
-					b1++
-				}
-				if a1 <= b2 {
-					b2++
-				}
-				if a2 <= b2 {
-					b2++
-				}
-				p := create([][2]int{[2]int{a1,a2}, [2]int{b1,b2}}, tt.width, tt.height)
-				res := Solve(p)
-				if res {
-					count++
-				}
-
-				if j+1 < bl {
-					nextCombination(bs, tt.width*tt.height-2)
-				}
+		count := countSolvable(tt.width, tt.height, paperSolver(tt.width, tt.height, Solve))
+		if count != tt.out {
+			t.Errorf("Expected %d, got %d for %x", tt.out, count, tt)
+		}
+	}
+}
+
+// Adapts a solver taking a Paper to one taking pairs of sources
+func paperSolver(width, height int, solve func(*Paper) bool) func([][2]int) bool {
+	return func(sources [][2]int) bool {
+		return solve(create(sources, width, height))
+	}
+}
+
+// Counts the number of ways to place two pairs of sources on a width x height
+// paper, such that solve finds the puzzle solvable
+func countSolvable(width, height int, solve func([][2]int) bool) int {
+	al := choose2(width*height)
+	bl := choose2(width*height-2)
+	count := 0
+	as := []int{0,1}
+	for i := 0; i < al; i++ {
+		bs := []int{0,1}
+		for j := 0; j < bl; j++ {
+			a1, a2 := as[0], as[1]
+			b1, b2 := bs[0], bs[1]
+			if a1 <= b1 {
+				b1++
+			}
+			if a2 <= b1 {
+				b1++
 			}
-			if i+1 < al {
-				nextCombination(as, tt.width*tt.height)
+			if a1 <= b2 {
+				b2++
+			}
+			if a2 <= b2 {
+				b2++
+			}
+			if solve([][2]int{[2]int{a1,a2}, [2]int{b1,b2}}) {
+				count++
+			}
+
+			if j+1 < bl {
+				nextCombination(bs, width*height-2)
 			}
 		}
+		if i+1 < al {
+			nextCombination(as, width*height)
+		}
+	}
+	return count
+}
 
-		if count != tt.out {
-			t.Errorf("Expected %d, got %d for %x", tt.out, count, tt)
+type corpusPuzzle struct {
+	width, height int
+	lines         []string
+}
+
+// Reads every puzzle of a file in the puzzles directory
+func readCorpus(b *testing.B, name string) []corpusPuzzle {
+	f, err := os.Open("../../puzzles/" + name)
+	if err != nil {
+		b.Skip(err.Error())
+	}
+	defer f.Close()
+	puzzles := make([]corpusPuzzle, 0)
+	reader := bufio.NewReader(f)
+	for {
+		w, h, lines, err := ReadPuzzle(reader)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			b.Fatal(err.Error())
+		}
+		puzzles = append(puzzles, corpusPuzzle{w, h, lines})
+	}
+	return puzzles
+}
+
+func benchmarkCorpus(b *testing.B, name string) {
+	puzzles := readCorpus(b, name)
+	solver := new(Solver)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, pz := range puzzles {
+			p, err := solver.Parse(pz.width, pz.height, pz.lines)
+			if err != nil {
+				b.Fatal(err.Error())
+			}
+			Solve(p)
+		}
+	}
+}
+
+func BenchmarkJanko(b *testing.B)   { benchmarkCorpus(b, "janko") }
+func BenchmarkInputs4(b *testing.B) { benchmarkCorpus(b, "inputs4") }
+func BenchmarkInputs6(b *testing.B) { benchmarkCorpus(b, "inputs6") }
+func BenchmarkInputs9(b *testing.B) { benchmarkCorpus(b, "inputs9") }
+
+var reusetests = []struct {
+	width, height int
+	lines         []string
+}{
+	{8, 8, []string{"A..AB...", "..CDE.E.", "..F.....", "..G.HI..", "....D...", "...C....", ".F.G..HB", ".......I"}},
+	{5, 4, []string{"C...B", "A.BA.", "...C.", "....."}},
+	{4, 4, []string{"....", ".ab.", "..b.", "a..."}},
+	{3, 2, []string{"a.a", "b.b"}},
+	{8, 8, []string{"A..AB...", "..CDE.E.", "..F.....", "..G.HI..", "....D...", "...C....", ".F.G..HB", ".......I"}},
+}
+
+func TestSolverReuse(t *testing.T) {
+	solver := new(Solver)
+	for _, tt := range reusetests {
+		p1, _ := Parse(tt.width, tt.height, tt.lines)
+		p2, _ := solver.Parse(tt.width, tt.height, tt.lines)
+		res1, res2 := Solve(p1), Solve(p2)
+		if res1 != res2 {
+			t.Errorf("Expected %t, got %t for %v", res1, res2, tt.lines)
+			continue
+		}
+		for pos := range p1.Table {
+			if p1.Table[pos] != p2.Table[pos] || p1.Con(pos) != p2.Con(pos) {
+				t.Errorf("Reused paper differs at position %d for %v", pos, tt.lines)
+				break
+			}
+		}
+	}
+}
+
+var holetests = []struct {
+	width, height int
+	lines         []string
+	solution      string
+}{
+	{3, 3, []string{"a..", "b#a", "..b"}, "aaa b#a bbb"},
+	{3, 3, []string{"a.a", ".#.", "..."}, ""},
+	{5, 5, []string{"....0", "0####", ".1...", ".2.1.", "....2"}, "00000 0#### 11222 12212 11112"},
+	{5, 4, []string{"#0#1#", "#0#.#", "##1.#", "2..2#"}, "#0#1# #0#1# ##11# 2222#"},
+	{4, 5, []string{"##.0", "11.2", "##0.", "###.", "33#2"}, "##00 1102 ##02 ###2 33#2"},
+}
+
+func TestHoles(t *testing.T) {
+	for _, tt := range holetests {
+		for name, solve := range backends {
+			p, err := Parse(tt.width, tt.height, tt.lines)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			solution := ""
+			if solve(p) {
+				solution = strings.Join(p.Letters(), " ")
+			}
+			if solution != tt.solution {
+				t.Errorf("Expected '%s' from %s for %v, got '%s'", tt.solution, name, tt.lines, solution)
+			}
+		}
+	}
+}
+
+var bridgetests = []struct {
+	width, height int
+	lines         []string
+	solution      string
+}{
+	{3, 5, []string{"d.d", "aba", ".┼.", ".┼.", "cbc"}, "ddd aba a┼a c┼c cbc"},
+	{3, 4, []string{"a.a", "bc#", ".┼.", "c.b"}, "aaa bc# b┼b ccb"},
+	{3, 3, []string{"a.b", ".┼.", "a.b"}, ""},
+}
+
+// The flow backend doesn't know about bridges
+func TestBridges(t *testing.T) {
+	for _, tt := range bridgetests {
+		for _, name := range []string{"sweep", "bits"} {
+			p, err := Parse(tt.width, tt.height, tt.lines)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			solution := ""
+			if backends[name](p) {
+				solution = strings.Join(p.Letters(), " ")
+			}
+			if solution != tt.solution {
+				t.Errorf("Expected '%s' from %s for %v, got '%s'", tt.solution, name, tt.lines, solution)
+			}
 		}
 	}
 }
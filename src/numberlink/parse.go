@@ -1,6 +1,11 @@
 package main
 
+import "bufio"
 import "fmt"
+import "io"
+import "math/bits"
+import "strconv"
+import "strings"
 
 type ParseError struct {
 	Line    int
@@ -12,19 +17,144 @@ func (e *ParseError) Error() string {
 }
 
 func Parse(width int, height int, lines []string) (*Paper, error) {
+	return new(Solver).Parse(width, height, lines)
+}
+
+// A Solver parses a stream of puzzles into the same Paper, so the memory is
+// reused rather than allocated again for every puzzle
+type Solver struct {
+	paper  Paper
+	table  []rune
+	fixed  []int
+	colors []rune
+}
+
+// Written after a label, makes the square before it a coloured square, which
+// must be part of the flow of that label
+const COLORED = '\u0332'
+
+// Like Parse, but the returned Paper is only valid until the next call
+func (solver *Solver) Parse(width int, height int, lines []string) (*Paper, error) {
 	if width*height == 0 {
 		return nil, &ParseError{0, "width and height cannot be 0"}
 	}
-	if width != len(lines[0]) || height != len(lines) {
+	if height != len(lines) {
 		return nil, &ParseError{1, "width and height must match puzzle size"}
 	}
 
-	table := make([]int32, 0, width*height)
-	for _, line := range lines {
+	// Besides sources and empty squares, the puzzle may have pieces of the
+	// flows drawn, and coloured squares. Holes and bridges are read like
+	// sources, and told apart by Load.
+	tube := make(map[rune]int)
+	for con, c := range TUBE {
+		if bits.OnesCount(uint(con)) == 2 {
+			tube[c] = con
+		}
+	}
+	table := solver.table[:0]
+	fixed := solver.fixed[:0]
+	colors := solver.colors[:0]
+	for y, line := range lines {
+		n := 0
 		for _, c := range line {
-			table = append(table, c)
+			switch con, found := tube[c]; {
+			case c == COLORED:
+				last := EMPTY
+				if n != 0 && fixed[len(fixed)-1] == 0 {
+					last = table[len(table)-1]
+				}
+				if last == EMPTY || last == GRASS || last == BRIDGE {
+					return nil, &ParseError{y + 1, "only labels can be coloured"}
+				}
+				colors[len(colors)-1] = table[len(table)-1]
+				table[len(table)-1] = EMPTY
+				continue
+			case found:
+				table = append(table, EMPTY)
+				fixed = append(fixed, con)
+			default:
+				table = append(table, c)
+				fixed = append(fixed, 0)
+			}
+			colors = append(colors, EMPTY)
+			n++
+		}
+		if n != width {
+			return nil, &ParseError{y + 1, "width and height must match puzzle size"}
+		}
+	}
+	solver.table, solver.fixed, solver.colors = table, fixed, colors
+
+	paper := solver.paper.Load(width, height, table)
+	for i := range table {
+		pos := (i/width+1)*paper.Width + i%width + 1
+		c := &paper.cells[pos]
+		if fixed[i] != 0 {
+			c.fixed = uint8(fixed[i])
+			c.flag |= FIXED
+		}
+		if colors[i] != EMPTY {
+			paper.colors[pos] = colors[i]
+			c.label = colors[i]
+		}
+	}
+	return paper, nil
+}
+
+// Check if the puzzle has drawn pieces or coloured squares
+func (paper *Paper) constrained() bool {
+	for pos, c := range paper.cells {
+		if c.fixed != 0 || paper.colors[pos] != EMPTY {
+			return true
 		}
 	}
+	return false
+}
 
-	return NewPaper(width, height, table), nil
+// Reads the next puzzle from the reader, in the format of a 'width height'
+// line followed by the lines of the puzzle. Empty lines and lines starting
+// with # are skipped. Returns io.EOF if there are no more puzzles, or if the
+// '0 0' end of puzzles mark is reached.
+func ReadPuzzle(reader *bufio.Reader) (int, int, []string, error) {
+	var line string
+	for {
+		var err error
+		line, err = reader.ReadString('\n')
+		if err != nil && (err != io.EOF || strings.TrimSpace(line) == "") {
+			return 0, 0, nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line != "" && line[0] != '#' {
+			break
+		}
+	}
+	parts := strings.Split(line, " ")
+	bad := len(parts) != 2
+	var w, h int
+	if !bad {
+		var err1, err2 error
+		w, err1 = strconv.Atoi(parts[0])
+		h, err2 = strconv.Atoi(parts[1])
+		bad = bad || err1 != nil || err2 != nil
+	}
+	if bad {
+		return 0, 0, nil, fmt.Errorf("Error: Expected 'width height' got '%s'", line)
+	}
+
+	// We use 0 0 as an end of puzzles mark
+	if w == 0 && h == 0 {
+		return 0, 0, nil, io.EOF
+	}
+	lines := make([]string, 0, h)
+	for i := 0; i < h; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, 0, nil, err
+		}
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	return w, h, lines, nil
 }
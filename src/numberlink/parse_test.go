@@ -0,0 +1,55 @@
+package main
+
+import "strings"
+import "testing"
+
+var constrainttests = []struct {
+	lines    []string
+	solution string
+}{
+	// The puzzle has two solutions, either of which can be picked by a
+	// drawn piece or a coloured square
+	{[]string{"c┌.b", ".bc.", ".aa.", "...."}, "cbbb cbcc caac cccc"},
+	{[]string{"c─.b", ".bc.", ".aa.", "...."}, "cccb bbcb baab bbbb"},
+	{[]string{"c..b", "c̲bc.", ".aa.", "...."}, "cbbb cbcc caac cccc"},
+	{[]string{"c..b", "b̲bc.", ".aa.", "...."}, "cccb bbcb baab bbbb"},
+	{[]string{"c..b", "b̲bc.", ".aa.", "...c̲"}, ""},
+	{[]string{"c..b", ".bc.", ".aa┐", "...."}, ""},
+}
+
+func TestParseConstraints(t *testing.T) {
+	for _, test := range constrainttests {
+		p, err := Parse(4, 4, test.lines)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !p.constrained() {
+			t.Errorf("Expected %v to be constrained", test.lines)
+		}
+		solution := ""
+		if Solve(p) {
+			solution = strings.Join(p.Letters(), " ")
+		}
+		if solution != test.solution {
+			t.Errorf("Expected '%s' for %v, got '%s'", test.solution, test.lines, solution)
+		}
+	}
+
+	p, _ := Parse(4, 4, []string{"c..b", ".bc.", ".aa.", "...."})
+	if p.constrained() {
+		t.Error("Expected a plain puzzle not to be constrained")
+	}
+	// The colours the search gives its links aren't marks of the puzzle
+	if !Solve(p) || p.constrained() {
+		t.Error("Expected a solved plain puzzle not to be constrained")
+	}
+	if err := Check(p, p.Letters()); err != nil {
+		t.Error(err.Error())
+	}
+	if _, err := Parse(2, 1, []string{".̲a"}); err == nil || err.Error() != "ParseError: 'only labels can be coloured' at line 1" {
+		t.Errorf("Expected an error for colouring an empty square, got %v", err)
+	}
+	if _, err := Parse(2, 2, []string{"ab", "abb"}); err == nil {
+		t.Error("Expected an error for a line of the wrong width")
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import "fmt"
+import "sync/atomic"
+import "time"
+
+// Remembers the state of the search with the most pairs connected, so there
+// is a best effort answer for puzzles that can't be solved, or can't be
+// solved in time
+type Partial struct {
+	budget   time.Duration
+	deadline time.Time
+	// The number of pairs connected without touching themselves right now,
+	// and the most seen so far
+	connected int
+	Best      int
+	best      []uint8
+	// Whether each completed flow, in the order they were completed, was
+	// counted in connected
+	clean []bool
+	// Set from another goroutine to stop the search
+	interrupt int32
+	// Whether the search was stopped by the budget or by Interrupt
+	Interrupted bool
+}
+
+// Makes a Partial which stops the search after budget, or never if 0
+func NewPartial(budget time.Duration) *Partial {
+	return &Partial{budget: budget}
+}
+
+// Start following the search of the puzzle loaded into paper
+func (pa *Partial) Start(paper *Paper) {
+	paper.partial = pa
+	paper.tickers = append(paper.tickers, pa.tick)
+	if pa.budget != 0 {
+		pa.deadline = time.Now().Add(pa.budget)
+	}
+	pa.connected, pa.Best, pa.best, pa.clean = 0, 0, pa.best[:0], pa.clean[:0]
+	atomic.StoreInt32(&pa.interrupt, 0)
+	pa.Interrupted = false
+}
+
+// Called by the search when the flow with a source at pos is completed
+// (delta 1) or taken back again (delta -1). Flows are taken back in the
+// opposite order of completion. Flows touching themselves aren't counted, as
+// Restore throws them away.
+func (pa *Partial) complete(paper *Paper, pos int, delta int) {
+	if delta < 0 {
+		if pa.clean[len(pa.clean)-1] {
+			pa.connected--
+		}
+		pa.clean = pa.clean[:len(pa.clean)-1]
+		return
+	}
+	clean := !touching(paper, followFlow(paper, pos))
+	pa.clean = append(pa.clean, clean)
+	if !clean {
+		return
+	}
+	pa.connected++
+	if pa.connected <= pa.Best {
+		return
+	}
+	pa.Best = pa.connected
+	pa.best = pa.best[:0]
+	for _, c := range paper.cells {
+		pa.best = append(pa.best, c.con)
+	}
+}
+
+func (pa *Partial) tick(paper *Paper, pos int) {
+	if atomic.LoadInt32(&pa.interrupt) != 0 || pa.budget != 0 && time.Now().After(pa.deadline) {
+		paper.stop, pa.Interrupted = true, true
+	}
+}
+
+// Make the search stop at the next tick. Safe to call from any goroutine.
+func (pa *Partial) Interrupt() {
+	atomic.StoreInt32(&pa.interrupt, 1)
+}
+
+// Put the most complete state seen back into the paper. Only the completed
+// flows not touching themselves are kept, everything else is left empty.
+func (pa *Partial) Restore(paper *Paper) {
+	for pos := range paper.cells {
+		paper.SetCon(pos, 0)
+	}
+	for pos, con := range pa.best {
+		paper.SetCon(pos, int(con))
+	}
+	keep := make([]bool, len(paper.cells))
+	for pos := range paper.cells {
+		if !paper.isSource(pos) || keep[pos] {
+			continue
+		}
+		flow := followFlow(paper, pos)
+		if last := flow[len(flow)-1]; last != pos && paper.Table[last] == paper.Table[pos] && !touching(paper, flow) {
+			for _, p := range flow {
+				keep[p] = true
+			}
+		}
+	}
+	for pos := range paper.cells {
+		if !keep[pos] {
+			paper.SetCon(pos, 0)
+		}
+	}
+}
+
+// The squares of the flow starting at the source pos, until it ends or
+// reaches another source
+func followFlow(paper *Paper, pos int) []int {
+	flow := []int{pos}
+	old := -1
+	for {
+		next := -1
+		for _, dir := range DIRS {
+			cand := paper.neighbour(pos, dir)
+			// Flows go straight over bridges
+			straight := paper.Table[pos] != BRIDGE || old == cand-2*paper.Vctr[dir]
+			if paper.Con(pos)&dir != 0 && cand != old && straight {
+				next = cand
+			}
+		}
+		if next == -1 {
+			return flow
+		}
+		flow = append(flow, next)
+		if paper.isSource(next) {
+			return flow
+		}
+		old, pos = pos, next
+	}
+}
+
+// Check if the flow runs next to itself anywhere it isn't connected
+func touching(paper *Paper, flow []int) bool {
+	in := make(map[int]bool)
+	for _, pos := range flow {
+		in[pos] = true
+	}
+	for _, pos := range flow {
+		for _, dir := range DIRS {
+			if paper.Con(pos)&dir == 0 && in[paper.neighbour(pos, dir)] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// The labels of the sources not connected to their pair, in the order they
+// first appear
+func unconnected(paper *Paper) []rune {
+	labels := make([]rune, 0)
+	seen := make(map[rune]bool)
+	for pos := range paper.cells {
+		if paper.isSource(pos) && paper.Con(pos) == 0 && !seen[paper.Table[pos]] {
+			seen[paper.Table[pos]] = true
+			labels = append(labels, paper.Table[pos])
+		}
+	}
+	return labels
+}
+
+// Print the paper like PrintTubes, after a line saying how many pairs are
+// connected. Sources not connected to their pair are shown in reverse video
+// if color is true, and listed in any case.
+func PrintPartial(paper *Paper, color bool) {
+	missing := unconnected(paper)
+	fmt.Printf("PARTIAL: %d of %d pairs connected\n", paper.countPairs()-len(missing), paper.countPairs())
+	for y := 1; y < paper.Height-1; y++ {
+		for x := 1; x < paper.Width-1; x++ {
+			pos := y*paper.Width + x
+			c := paper.Table[pos]
+			switch {
+			case c == EMPTY:
+				fmt.Printf("%c", TUBE[paper.Con(pos)])
+			case color && paper.Con(pos) == 0:
+				fmt.Printf("%s%c%s", REVERSE, c, RESET)
+			default:
+				fmt.Printf("%c", c)
+			}
+		}
+		fmt.Println()
+	}
+	if len(missing) != 0 {
+		fmt.Printf("Unconnected: %s\n", listLabels(missing))
+	}
+}
+
+// The number of different labels on the paper
+func (paper *Paper) countPairs() int {
+	seen := make(map[rune]bool)
+	for pos := range paper.cells {
+		if paper.isSource(pos) {
+			seen[paper.Table[pos]] = true
+		}
+	}
+	return len(seen)
+}
@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestPartial(t *testing.T) {
+	// Both flows can be completed, but a always touches itself
+	p, _ := Parse(4, 4, []string{
+		"....",
+		".ab.",
+		"..b.",
+		"a...",
+	})
+	pa := NewPartial(0)
+	pa.Start(p)
+	if Solve(p) {
+		t.Fatal("Expected the puzzle to be impossible")
+	}
+	if pa.Best != 1 || pa.Interrupted {
+		t.Errorf("Expected 1 pair connected without interruption, got %d", pa.Best)
+	}
+	pa.Restore(p)
+	if missing := unconnected(p); string(missing) != "a" {
+		t.Errorf("Expected only a to be unconnected, got '%s'", string(missing))
+	}
+
+	// Running out of time stops the search
+	defer func(mask int) { TICK_MASK = mask }(TICK_MASK)
+	TICK_MASK = 1<<6 - 1
+	p, _ = Parse(14, 14, checkpointtest)
+	pa = NewPartial(1)
+	pa.Start(p)
+	if Solve(p) || !pa.Interrupted {
+		t.Error("Expected the search to run out of time")
+	}
+
+	// An interrupt only stops the search it was made during
+	pa = NewPartial(0)
+	p, _ = Parse(14, 14, checkpointtest)
+	pa.Start(p)
+	pa.Interrupt()
+	if Solve(p) || !pa.Interrupted {
+		t.Error("Expected the search to be interrupted")
+	}
+	p, _ = Parse(14, 14, checkpointtest)
+	pa.Start(p)
+	if !Solve(p) || pa.Interrupted {
+		t.Error("Expected the interrupt to be cleared by Start")
+	}
+}
@@ -43,16 +43,24 @@ func PrintSimple(paper *Paper, color bool) {
 
 // Print the paper using unicode table characters such as └ and │
 // If color is true, each flow will be colored by one of 16 terminal color
-// codes
+// codes. On wrapped papers, the joined edges get a margin marking where flows
+// cross them.
 func PrintTubes(paper *Paper, color bool) {
 	colors := makeColorTable(paper, !color)
-	for y := 1; y < paper.Height-1; y++ {
-		for x := 1; x < paper.Width-1; x++ {
-			pos := y*paper.Width + x
+	w, h := paper.Width, paper.Height
+	if paper.Wrap&N != 0 {
+		printEdge(paper, 1, N, colors)
+	}
+	for y := 1; y < h-1; y++ {
+		if paper.Wrap&W != 0 {
+			fmt.Print(edgeMark(paper, y*w+1, W, colors))
+		}
+		for x := 1; x < w-1; x++ {
+			pos := y*w + x
 			val := paper.Table[pos]
 			var c rune
 			if val == EMPTY {
-				c = TUBE[paper.Con[pos]]
+				c = TUBE[paper.Con(pos)]
 			} else {
 				c = val
 			}
@@ -62,8 +70,42 @@ func PrintTubes(paper *Paper, color bool) {
 				fmt.Printf("%s%c%s", col, c, RESET)
 			}
 		}
+		if paper.Wrap&E != 0 {
+			fmt.Print(edgeMark(paper, y*w+w-2, E, colors))
+		}
 		fmt.Println()
 	}
+	if paper.Wrap&S != 0 {
+		printEdge(paper, h-2, S, colors)
+	}
+}
+
+// Print the marks outside row y, on the side in direction dir, lined up
+// with the squares of the row
+func printEdge(paper *Paper, y, dir int, colors []string) {
+	if paper.Wrap&W != 0 {
+		fmt.Print(" ")
+	}
+	for x := 1; x < paper.Width-1; x++ {
+		fmt.Print(edgeMark(paper, y*paper.Width+x, dir, colors))
+	}
+	fmt.Println()
+}
+
+// The mark outside the square at pos in direction dir, which is a line if its
+// flow crosses the edge there
+func edgeMark(paper *Paper, pos, dir int, colors []string) string {
+	if paper.Con(pos)&dir == 0 {
+		return " "
+	}
+	mark := "│"
+	if dir&(E|W) != 0 {
+		mark = "─"
+	}
+	if colors[pos] != "" {
+		return colors[pos] + mark + RESET
+	}
+	return mark
 }
 
 // Assigns a terminal color code to every position on the paper
@@ -83,6 +125,9 @@ func makeColorTable(paper *Paper, empty bool) []string {
 		for y := 1; y < paper.Height-1; y++ {
 			for x := 1; x < paper.Width-1; x++ {
 				c := table[y*paper.Width+x]
+				if c == GRASS || c == BRIDGE {
+					continue
+				}
 				if _, found := mapping[c]; !found {
 					if len(available) >= 1 {
 						mapping[c] = available[next]
@@ -100,21 +145,24 @@ func makeColorTable(paper *Paper, empty bool) []string {
 
 // Does a bfs search on every source, filling out its connected nodes
 // This is neccesary since we normally store only relative connection
-// information
+// information. Bridges are crossed, but keep their ┼.
 func fillTable(paper *Paper) []rune {
 	w, h := paper.Width, paper.Height
 	table := make([]rune, w*h)
 	copy(table, paper.Table)
 	for pos := 0; pos < w*h; pos++ {
-		if paper.source[pos] {
+		if paper.isSource(pos) {
 			queue := list.New()
 			queue.PushBack(pos)
 			for queue.Len() != 0 {
 				pos := queue.Remove(queue.Front()).(int)
 				paint := table[pos]
 				for _, dir := range DIRS {
-					next := pos + paper.Vctr[dir]
-					if paper.Con[pos]&dir != 0 && table[next] == EMPTY {
+					next := paper.neighbour(pos, dir)
+					for paper.Con(pos)&dir != 0 && table[next] == BRIDGE && paper.Con(next)&dir != 0 {
+						next = paper.neighbour(next, dir)
+					}
+					if paper.Con(pos)&dir != 0 && table[next] == EMPTY {
 						table[next] = paint
 						queue.PushBack(next)
 					}
@@ -0,0 +1,106 @@
+package main
+
+import "fmt"
+import "io"
+import "sync/atomic"
+import "time"
+
+// Reports how a long search is doing, and remembers the deepest position it
+// has reached, so there is something to show if it is interrupted
+type Progress struct {
+	out      io.Writer
+	interval time.Duration
+	start    time.Time
+	last     time.Time
+	calls    int
+	// The number of squares before each position in the diagonal order
+	depth []int
+	// The deepest position reached
+	Deepest int
+	// The connections at the deepest position seen by a tick. Copying the
+	// paper at every new deepest position would take time quadratic in its
+	// size, so the ticks keep a snapshot instead.
+	bestDepth int
+	best      []uint8
+	// Set from another goroutine to stop the search
+	interrupt int32
+	// Whether the search was stopped by Interrupt
+	Interrupted bool
+}
+
+// Makes a progress reporter writing to out every interval
+func NewProgress(out io.Writer, interval time.Duration) *Progress {
+	return &Progress{out: out, interval: interval}
+}
+
+// Start following the search of the puzzle loaded into paper
+func (pr *Progress) Start(paper *Paper) {
+	paper.progress = pr
+	paper.tickers = append(paper.tickers, pr.tick)
+	pr.depth = pr.depth[:0]
+	for range paper.cells {
+		pr.depth = append(pr.depth, 0)
+	}
+	depth := 0
+	for p := paper.first(); p != 0; p = int(paper.cells[p].next) {
+		pr.depth[p] = depth
+		depth++
+	}
+	pr.depth[0] = depth
+	pr.start, pr.last, pr.calls = time.Now(), time.Now(), Calls
+	pr.Deepest, pr.bestDepth, pr.best = -1, -1, pr.best[:0]
+	atomic.StoreInt32(&pr.interrupt, 0)
+	pr.Interrupted = false
+}
+
+// Called by the search each time it gets to pos
+func (pr *Progress) visit(paper *Paper, pos int) {
+	if pr.depth[pos] > pr.Deepest {
+		pr.Deepest = pr.depth[pos]
+	}
+}
+
+func (pr *Progress) tick(paper *Paper, pos int) {
+	if pr.depth[pos] > pr.bestDepth {
+		pr.bestDepth = pr.depth[pos]
+		pr.best = pr.best[:0]
+		for _, c := range paper.cells {
+			pr.best = append(pr.best, c.con)
+		}
+	}
+	if atomic.LoadInt32(&pr.interrupt) != 0 {
+		paper.stop, pr.Interrupted = true, true
+		return
+	}
+	now := time.Now()
+	if now.Sub(pr.last) < pr.interval {
+		return
+	}
+	rate := float64(Calls-pr.calls) / now.Sub(pr.last).Seconds()
+	fmt.Fprintf(pr.out, "Elapsed %v, %.0f calls/s, deepest %.1f%%\n",
+		now.Sub(pr.start).Round(time.Second), rate, pr.Percent())
+	pr.last, pr.calls = now, Calls
+}
+
+// How far into the diagonal order the search has been, in percent
+func (pr *Progress) Percent() float64 {
+	return 100 * float64(pr.Deepest) / float64(pr.depth[0])
+}
+
+// How far into the diagonal order the fill put back by Best is, in percent
+func (pr *Progress) BestPercent() float64 {
+	return 100 * float64(pr.bestDepth) / float64(pr.depth[0])
+}
+
+// Make the search stop at the next tick. Safe to call from any goroutine.
+func (pr *Progress) Interrupt() {
+	atomic.StoreInt32(&pr.interrupt, 1)
+}
+
+// Put the connections from the deepest position seen by a tick back into the
+// paper
+func (pr *Progress) Best(paper *Paper) {
+	for pos, con := range pr.best {
+		paper.SetCon(pos, int(con))
+	}
+}
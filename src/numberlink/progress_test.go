@@ -0,0 +1,52 @@
+package main
+
+import "io/ioutil"
+import "testing"
+
+func TestProgress(t *testing.T) {
+	defer func(mask int) { TICK_MASK = mask }(TICK_MASK)
+	TICK_MASK = 1<<6 - 1
+
+	// A solved puzzle has been all the way through the diagonal order
+	pr := NewProgress(ioutil.Discard, 0)
+	p, _ := Parse(14, 14, checkpointtest)
+	pr.Start(p)
+	if !Solve(p) {
+		t.Fatal("Expected the puzzle to be solvable")
+	}
+	if pr.Percent() != 100 || pr.Interrupted {
+		t.Errorf("Expected a finished search at 100%%, got %.1f%%", pr.Percent())
+	}
+
+	// An interrupted search stops at the next tick, and keeps its deepest fill
+	p, _ = Parse(14, 14, checkpointtest)
+	pr.Start(p)
+	pr.Interrupt()
+	if Solve(p) {
+		t.Fatal("Expected the interrupted search to fail")
+	}
+	if !pr.Interrupted || pr.Percent() >= 100 {
+		t.Errorf("Expected an interrupted search, got %.1f%%", pr.Percent())
+	}
+	if pr.BestPercent() > pr.Percent() {
+		t.Errorf("Expected the kept fill to be at most as deep as the search went, got %.1f%%", pr.BestPercent())
+	}
+	p, _ = Parse(14, 14, checkpointtest)
+	pr.Best(p)
+	connected := 0
+	for pos := range p.cells {
+		if p.Con(pos) != 0 {
+			connected++
+		}
+	}
+	if connected == 0 {
+		t.Error("Expected the deepest fill to have connections")
+	}
+
+	// The next puzzle starts over, without the interrupt
+	p, _ = Parse(14, 14, checkpointtest)
+	pr.Start(p)
+	if !Solve(p) || pr.Interrupted {
+		t.Error("Expected the interrupt to be cleared by Start")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import "fmt"
+import "math"
+import "strings"
+
+// How hard a puzzle is for a person, and what went into deciding it
+type Rating struct {
+	// From 0 for trivial puzzles, to 10 for the hardest of puzzles/janko
+	Score float64
+	// How often each rule of the logic solver was used
+	Rules [DEDUCTIONS]int
+	// How many times the logic solver got stuck and had to guess
+	Guesses int
+	// The size of the search tree of the sweep solver
+	Calls   int
+	Squares int
+	Pairs   int
+}
+
+// Rate the puzzle loaded into paper. Returns false if it has no solution.
+// The paper is left with the solution.
+func Rate(paper *Paper) (*Rating, bool) {
+	// A copy with the drawn pieces and coloured squares, for the logic solver
+	q := paper.require(nil)
+	rating := &Rating{
+		Squares: (paper.Width - 2) * (paper.Height - 2),
+		Pairs:   paper.countPairs(),
+	}
+	calls := Calls
+	if !Solve(paper) {
+		return nil, false
+	}
+	rating.Calls = Calls - calls
+
+	rating.guess(q, paper)
+	rating.Score = rating.score()
+	return rating, true
+}
+
+// Solve the puzzle loaded into paper with the logic solver. Whenever it gets
+// stuck, take a lucky guess at the square with the fewest ways to connect, by
+// drawing a line of the solution.
+func (rating *Rating) guess(paper, solution *Paper) {
+	l := newLogic(paper)
+	for {
+		steps, solved, err := l.run()
+		for _, step := range steps {
+			rating.Rules[step.Rule]++
+		}
+		if solved || err != nil {
+			return
+		}
+		pos, dirs := l.branch()
+		guessed := false
+		for _, dir := range dirs {
+			if solution.Con(pos)&dir != 0 && !guessed {
+				paper.connect(pos, dir)
+				guessed = true
+			}
+		}
+		if !guessed {
+			return
+		}
+		rating.Guesses++
+	}
+}
+
+// Combine what went into the rating. The weights are picked so the puzzles of
+// puzzles/janko spread over the whole scale, while the Flow Free puzzles of
+// puzzles/inputs1 end up below 2, and no puzzle gets more than 10.
+func (rating *Rating) score() float64 {
+	score := math.Log2(float64(1 + rating.Guesses))
+	score += 0.8 * math.Max(0, math.Log10(float64(rating.Calls))-1.8)
+	score += 0.6 * math.Log2(float64(rating.Squares)/64)
+	// Few pairs make for long flows, which are harder to see
+	score += 10 * math.Max(0, 0.12-float64(rating.Pairs)/float64(rating.Squares))
+	if rating.Rules[DEDUCE_CUT] != 0 {
+		score += 0.5
+	}
+	return math.Max(0, math.Min(10, 0.75*score))
+}
+
+// Print the score, followed by what went into it
+func PrintRating(rating *Rating) {
+	rules := make([]string, 0)
+	for rule, count := range rating.Rules {
+		if count != 0 {
+			rules = append(rules, fmt.Sprintf("%s %d", DEDUCTION_NAMES[rule], count))
+		}
+	}
+	fmt.Printf("RATING: %.1f\n", rating.Score)
+	fmt.Printf("Rules: %s\n", strings.Join(rules, ", "))
+	fmt.Printf("Guesses: %d, calls: %d, squares: %d, pairs: %d\n", rating.Guesses, rating.Calls, rating.Squares, rating.Pairs)
+}
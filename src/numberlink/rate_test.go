@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestRate(t *testing.T) {
+	easy, _ := Parse(8, 8, []string{
+		"......ED",
+		".D......",
+		"........",
+		"E.......",
+		"G..B....",
+		"....C...",
+		"....F.CF",
+		"....G..B",
+	})
+	rating, ok := Rate(easy)
+	if !ok {
+		t.Fatal("Expected the puzzle to be solvable")
+	}
+	if rating.Guesses != 0 || rating.Rules[DEDUCE_CORNER] != 2 || rating.Squares != 64 || rating.Pairs != 6 {
+		t.Errorf("Unexpected rating %+v", rating)
+	}
+	if err := Check(easy, easy.Letters()); err != nil {
+		t.Errorf("Expected the paper to hold the solution, got %s", err.Error())
+	}
+
+	hard, _ := Parse(14, 14, checkpointtest)
+	harder, ok := Rate(hard)
+	if !ok || harder.Guesses == 0 || harder.Score <= rating.Score || harder.Score > 10 {
+		t.Errorf("Expected a harder rating than %.1f, got %+v", rating.Score, harder)
+	}
+
+	// The coloured square is kept for the logic solver
+	marked, _ := Parse(4, 4, []string{"c..b", "b̲bc.", ".aa.", "...."})
+	if rating, ok := Rate(marked); !ok || rating.Guesses != 0 {
+		t.Errorf("Expected the coloured square to leave nothing to guess, got %+v", rating)
+	}
+
+	p, _ := Parse(3, 3, []string{"ab.", "...", "ab."})
+	if _, ok := Rate(p); ok {
+		t.Error("Expected the puzzle to be impossible")
+	}
+}
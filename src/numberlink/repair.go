@@ -0,0 +1,133 @@
+package main
+
+import "fmt"
+
+// How many solutions to look at when finding the ambiguous squares to repair
+const REPAIR_SOLUTIONS = 10
+
+// A puzzle made unique by a single edit
+type Repair struct {
+	Description string
+	Puzzle      []string
+}
+
+// Propose up to limit edits to the puzzle loaded into paper, that each make
+// it unique. The edits are made to the flows of the first solution running
+// through ambiguous squares: either a flow is split in two pairs, or one of
+// its sources is moved along it. Each edit is checked by counting the
+// solutions. Also returns the number of solutions of the original puzzle, up
+// to REPAIR_SOLUTIONS, as there is nothing to repair unless it is at least 2.
+func Repairs(paper *Paper, limit int) ([]Repair, int) {
+	puzzle := paper.Letters()
+	heat := Ambiguity(paper, REPAIR_SOLUTIONS)
+	if heat.Solutions < 2 {
+		return nil, heat.Solutions
+	}
+
+	used := make(map[rune]bool)
+	for _, c := range paper.Table {
+		used[c] = true
+	}
+	label := EMPTY
+	for _, c := range SIGMA {
+		if !used[c] {
+			label = c
+			break
+		}
+	}
+
+	repairs := make([]Repair, 0)
+	try := func(description string, edit map[int]rune) bool {
+		lines := make([]string, len(puzzle))
+		for y := range puzzle {
+			row := []rune(puzzle[y])
+			for x := range row {
+				if c, found := edit[(y+1)*paper.Width+x+1]; found {
+					row[x] = c
+				}
+			}
+			lines[y] = string(row)
+		}
+		q, err := Parse(paper.Width-2, paper.Height-2, lines)
+		if err == nil && CountSolutions(q, 2) == 1 {
+			repairs = append(repairs, Repair{description, lines})
+		}
+		return len(repairs) < limit
+	}
+
+	seen := make(map[int]bool)
+	for pos := range paper.cells {
+		if !paper.isSource(pos) || seen[pos] {
+			continue
+		}
+		flow := followFlow(paper, pos)
+		seen[flow[len(flow)-1]] = true
+		ambiguous := false
+		for _, p := range flow {
+			ambiguous = ambiguous || heat.Ambiguous[p]
+		}
+		if !ambiguous {
+			continue
+		}
+		c := paper.Table[pos]
+
+		// Both parts of a split flow must keep two squares, and sources
+		// can't go on bridges
+		for i := 1; label != EMPTY && i+2 < len(flow); i++ {
+			a, b := flow[i], flow[i+1]
+			if !heat.Ambiguous[a] && !heat.Ambiguous[b] || paper.Table[a] == BRIDGE || paper.Table[b] == BRIDGE {
+				continue
+			}
+			description := fmt.Sprintf("Split %c between %s and %s, calling the second part %c", c, paper.coord(a), paper.coord(b), label)
+			if !try(description, map[int]rune{a: c, b: label, flow[len(flow)-1]: label}) {
+				return repairs, heat.Solutions
+			}
+		}
+
+		// Move either source to an ambiguous square of the flow, so the
+		// squares left behind have to be taken by other flows
+		for _, end := range []int{flow[0], flow[len(flow)-1]} {
+			for _, p := range flow[1 : len(flow)-1] {
+				if !heat.Ambiguous[p] || paper.Table[p] == BRIDGE {
+					continue
+				}
+				description := fmt.Sprintf("Move %c from %s to %s", c, paper.coord(end), paper.coord(p))
+				if !try(description, map[int]rune{end: EMPTY, p: c}) {
+					return repairs, heat.Solutions
+				}
+			}
+		}
+	}
+	return repairs, heat.Solutions
+}
+
+// The position as (x,y), counting from the top left square
+func (paper *Paper) coord(pos int) string {
+	return fmt.Sprintf("(%d,%d)", pos%paper.Width-1, pos/paper.Width-1)
+}
+
+// Print each repair as a puzzle, in the input format, with a comment saying
+// what was changed
+func PrintRepairs(paper *Paper, repairs []Repair, solutions int) {
+	switch {
+	case solutions == 0:
+		fmt.Println("IMPOSSIBLE")
+		return
+	case solutions == 1:
+		fmt.Println("# Unique")
+		return
+	case len(repairs) == 0:
+		fmt.Println("# No single edit makes the puzzle unique")
+		return
+	}
+	for i, repair := range repairs {
+		if i != 0 {
+			fmt.Println()
+		}
+		fmt.Printf("# %s\n", repair.Description)
+		fmt.Println(paper.Width-2, paper.Height-2)
+		for _, line := range repair.Puzzle {
+			fmt.Println(line)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestRepairs(t *testing.T) {
+	p, _ := Parse(4, 5, []string{
+		"b...",
+		".ca.",
+		"....",
+		".ac.",
+		"...b",
+	})
+	repairs, solutions := Repairs(p, 3)
+	if solutions != 2 || len(repairs) != 3 {
+		t.Fatalf("Expected 3 repairs of a puzzle with 2 solutions, got %d and %d", len(repairs), solutions)
+	}
+	if repairs[0].Description != "Split b between (1,0) and (2,0), calling the second part 0" {
+		t.Errorf("Unexpected first repair '%s'", repairs[0].Description)
+	}
+	for _, repair := range repairs {
+		q, err := Parse(4, 5, repair.Puzzle)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if count := CountSolutions(q, 2); count != 1 {
+			t.Errorf("Expected '%s' to make the puzzle unique, got %d solutions", repair.Description, count)
+		}
+	}
+
+	p, _ = Parse(14, 14, checkpointtest)
+	if repairs, solutions := Repairs(p, 3); solutions != 1 || len(repairs) != 0 {
+		t.Errorf("Expected nothing to repair, got %d repairs and %d solutions", len(repairs), solutions)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import "encoding/json"
+import "fmt"
+import "io"
+
+// The rules that prune the search in chooseConnection and tryConnection
+const (
+	PRUNE_NE_CORNER = iota
+	PRUNE_NW_CORNER
+	PRUNE_NE_TURN
+	PRUNE_NW_TURN
+	PRUNE_CAN_SE
+	PRUNE_CAN_SW
+	PRUNE_IMPLICIT_SE
+	PRUNE_SW_LANE
+	PRUNE_FULL_SOURCE
+	PRUNE_GRASS
+	PRUNE_SOURCES
+	PRUNE_LOOP
+	PRUNE_TIGHT_CORNER
+	PRUNE_VALIDATE
+	PRUNE_FIXED
+	PRUNE_BRIDGE
+	PRUNE_DEGREE
+	PRUNE_TOUCHING
+	PRUNE_RULES
+)
+
+var RULE_NAMES = [PRUNE_RULES]string{
+	PRUNE_NE_CORNER:    "ne-corner",
+	PRUNE_NW_CORNER:    "nw-corner",
+	PRUNE_NE_TURN:      "ne-turn",
+	PRUNE_NW_TURN:      "nw-turn",
+	PRUNE_CAN_SE:       "can-se",
+	PRUNE_CAN_SW:       "can-sw",
+	PRUNE_IMPLICIT_SE:  "implicit-se",
+	PRUNE_SW_LANE:      "sw-lane",
+	PRUNE_FULL_SOURCE:  "full-source",
+	PRUNE_GRASS:        "grass",
+	PRUNE_SOURCES:      "sources",
+	PRUNE_LOOP:         "loop",
+	PRUNE_TIGHT_CORNER: "tight-corner",
+	PRUNE_VALIDATE:     "validate",
+	PRUNE_FIXED:        "fixed",
+	PRUNE_BRIDGE:       "bridge",
+	PRUNE_DEGREE:       "degree",
+	PRUNE_TOUCHING:     "touching",
+}
+
+// Counts how often each rule prunes the search, in total and on each
+// diagonal. Diagonal d is the squares with x+y = d, counting from 0 in the
+// upper left corner. Failed validations are counted on the last diagonal.
+type Stats struct {
+	Calls     int
+	Rules     [PRUNE_RULES]int
+	DiagCalls []int
+	DiagRules [][PRUNE_RULES]int
+}
+
+func NewStats(paper *Paper) *Stats {
+	diagonals := paper.Width - 2 + paper.Height - 2 - 1
+	return &Stats{
+		DiagCalls: make([]int, diagonals),
+		DiagRules: make([][PRUNE_RULES]int, diagonals),
+	}
+}
+
+// Start counting the pruning of the paper's search
+func (paper *Paper) CollectStats() *Stats {
+	paper.stats = NewStats(paper)
+	return paper.stats
+}
+
+func (stats *Stats) diagonal(paper *Paper, pos int) int {
+	if pos == 0 {
+		return len(stats.DiagCalls) - 1
+	}
+	return pos%paper.Width - 1 + pos/paper.Width - 1
+}
+
+func (stats *Stats) visit(paper *Paper, pos int) {
+	stats.Calls++
+	stats.DiagCalls[stats.diagonal(paper, pos)]++
+}
+
+// Count that rule stopped the search from connecting pos in the directions
+// dirs. Always returns false, so it can be chained onto the condition that
+// failed.
+func (paper *Paper) pruned(rule int, pos int, dirs int) bool {
+	if stats := paper.stats; stats != nil {
+		stats.Rules[rule]++
+		stats.DiagRules[stats.diagonal(paper, pos)][rule]++
+	}
+	if paper.trace != nil {
+		paper.trace.record(paper, "reject", pos, dirs, RULE_NAMES[rule])
+	}
+	return false
+}
+
+// Print the totals, followed by a row for each diagonal that was visited
+func (stats *Stats) PrintTable(w io.Writer) {
+	fmt.Fprintf(w, "%-8s %12s", "diagonal", "calls")
+	for _, name := range RULE_NAMES {
+		fmt.Fprintf(w, " %12s", name)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%-8s %12d", "total", stats.Calls)
+	for _, count := range stats.Rules {
+		fmt.Fprintf(w, " %12d", count)
+	}
+	fmt.Fprintln(w)
+	for d, calls := range stats.DiagCalls {
+		if calls == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%-8d %12d", d, calls)
+		for _, count := range stats.DiagRules[d] {
+			fmt.Fprintf(w, " %12d", count)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+type jsonStats struct {
+	Calls     int            `json:"calls"`
+	Rules     map[string]int `json:"rules"`
+	Diagonals []jsonDiagonal `json:"diagonals"`
+}
+
+type jsonDiagonal struct {
+	Diagonal int            `json:"diagonal"`
+	Calls    int            `json:"calls"`
+	Rules    map[string]int `json:"rules"`
+}
+
+// Print the counts as a single line of JSON
+func (stats *Stats) PrintJSON(w io.Writer) error {
+	rules := func(counts [PRUNE_RULES]int) map[string]int {
+		m := make(map[string]int)
+		for rule, count := range counts {
+			m[RULE_NAMES[rule]] = count
+		}
+		return m
+	}
+	js := jsonStats{stats.Calls, rules(stats.Rules), make([]jsonDiagonal, 0)}
+	for d, calls := range stats.DiagCalls {
+		if calls != 0 {
+			js.Diagonals = append(js.Diagonals, jsonDiagonal{d, calls, rules(stats.DiagRules[d])})
+		}
+	}
+	data, err := json.Marshal(js)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
@@ -0,0 +1,57 @@
+package main
+
+import "bytes"
+import "encoding/json"
+import "testing"
+
+func TestStats(t *testing.T) {
+	// Touching flows, so the only complete fill fails validation
+	p, _ := Parse(4, 4, []string{
+		"....",
+		".ab.",
+		"..b.",
+		"a...",
+	})
+	stats := p.CollectStats()
+	Calls = 0
+	if Solve(p) {
+		t.Fatal("Expected the puzzle to be impossible")
+	}
+	if stats.Calls != Calls {
+		t.Errorf("Counted %d calls, expected %d", stats.Calls, Calls)
+	}
+	sum := 0
+	for _, calls := range stats.DiagCalls {
+		sum += calls
+	}
+	if sum != Calls {
+		t.Errorf("Diagonal calls sum to %d, expected %d", sum, Calls)
+	}
+	for rule, total := range stats.Rules {
+		sum := 0
+		for _, counts := range stats.DiagRules {
+			sum += counts[rule]
+		}
+		if sum != total {
+			t.Errorf("Rule %s counted %d times on diagonals, but %d in total", RULE_NAMES[rule], sum, total)
+		}
+	}
+	if stats.Rules[PRUNE_VALIDATE] == 0 {
+		t.Error("Expected a failed validation to be counted")
+	}
+
+	var buf bytes.Buffer
+	if err := stats.PrintJSON(&buf); err != nil {
+		t.Fatal(err.Error())
+	}
+	var out struct {
+		Calls int
+		Rules map[string]int
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err.Error())
+	}
+	if out.Calls != Calls || out.Rules["validate"] != stats.Rules[PRUNE_VALIDATE] {
+		t.Errorf("Unexpected JSON output: %s", buf.String())
+	}
+}
@@ -43,6 +43,11 @@ func printThemAll(w, h int) {
 	fmt.Println(al, bl)
 	count := 0
 	max := 0
+	// Small papers are much faster to go through with bitboards
+	var solver *BitSolver
+	if w*h <= MaxBitSquares {
+		solver = NewBitSolver(w, h)
+	}
 	as := []int{0,1}
 	for i := 0; i < al; i++ {
 		bs := []int{0,1}
@@ -61,8 +66,18 @@ func printThemAll(w, h int) {
 			if a2 <= b2 {
 				b2++
 			}
-			p := create([][2]int{[2]int{a1,a2}, [2]int{b1,b2}}, w, h)
-			res := Solve(p)
+			sources := [][2]int{[2]int{a1,a2}, [2]int{b1,b2}}
+			var p *Paper
+			var res bool
+			if solver != nil {
+				if res = solver.Solve(sources); res {
+					p = create(sources, w, h)
+					solver.CopyTo(p)
+				}
+			} else {
+				p = create(sources, w, h)
+				res = Solve(p)
+			}
 			if res {
 				PrintTubes(p, true)
 				fmt.Println(Calls)
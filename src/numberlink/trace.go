@@ -0,0 +1,167 @@
+package main
+
+import "bufio"
+import "encoding/json"
+import "fmt"
+import "io"
+import "strings"
+
+// A decision of the search, written as a line of JSON. Before the decisions
+// of each puzzle, a "puzzle" event holds the puzzle itself, so a trace can be
+// replayed on its own.
+//
+// The events are:
+//
+//	puzzle: the search of a new puzzle starts
+//	accept: pos is connected in the direction option
+//	undo:   the connection is taken back again, when backtracking
+//	reject: the rule reason stopped pos from being connected in option
+//	solved: the paper was filled and validated
+type TraceEvent struct {
+	Step   int    `json:"step"`
+	Event  string `json:"event"`
+	Pos    int    `json:"pos"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Option string `json:"option,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// The number of squares before pos in the diagonal order, which is
+	// also the depth of the recursion
+	Depth int `json:"depth"`
+
+	Width  int      `json:"width,omitempty"`
+	Height int      `json:"height,omitempty"`
+	Lines  []string `json:"lines,omitempty"`
+}
+
+type Tracer struct {
+	out  *bufio.Writer
+	enc  *json.Encoder
+	step int
+	// The depth of each position on the paper being traced
+	depth []int
+}
+
+func NewTracer(w io.Writer) *Tracer {
+	out := bufio.NewWriter(w)
+	return &Tracer{out: out, enc: json.NewEncoder(out)}
+}
+
+// Start tracing the search of the puzzle loaded into paper
+func (tracer *Tracer) Start(paper *Paper) {
+	paper.trace = tracer
+	tracer.depth = tracer.depth[:0]
+	for range paper.cells {
+		tracer.depth = append(tracer.depth, 0)
+	}
+	depth := 0
+	for p := paper.first(); p != 0; p = int(paper.cells[p].next) {
+		tracer.depth[p] = depth
+		depth++
+	}
+	tracer.depth[0] = depth
+
+	tracer.step++
+	tracer.write(paper, &TraceEvent{
+		Step:   tracer.step,
+		Event:  "puzzle",
+		Width:  paper.Width - 2,
+		Height: paper.Height - 2,
+		Lines:  paper.lines(),
+	})
+}
+
+func (tracer *Tracer) record(paper *Paper, event string, pos int, dirs int, reason string) {
+	tracer.step++
+	tracer.write(paper, &TraceEvent{
+		Step:   tracer.step,
+		Event:  event,
+		Pos:    pos,
+		X:      pos%paper.Width - 1,
+		Y:      pos/paper.Width - 1,
+		Option: dirName(dirs),
+		Reason: reason,
+		Depth:  tracer.depth[pos],
+	})
+}
+
+func (tracer *Tracer) write(paper *Paper, event *TraceEvent) {
+	if err := tracer.enc.Encode(event); err != nil && paper.err == nil {
+		paper.stop, paper.err = true, err
+	}
+}
+
+// Write out any buffered events
+func (tracer *Tracer) Flush() error {
+	return tracer.out.Flush()
+}
+
+// Names a set of directions, like "E|S"
+func dirName(dirs int) string {
+	names := make([]string, 0, 4)
+	for i, dir := range DIRS {
+		if dirs&dir != 0 {
+			names = append(names, string("NESW"[i]))
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// Read a trace up to the given step, and return the board as it was right
+// after that step, along with the event of the step. If step is 0, the whole
+// trace is read.
+func ReplayTrace(reader io.Reader, step int) (*Paper, *TraceEvent, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, 1<<24)
+	var paper *Paper
+	var event *TraceEvent
+	for scanner.Scan() {
+		event = new(TraceEvent)
+		if err := json.Unmarshal(scanner.Bytes(), event); err != nil {
+			return nil, nil, fmt.Errorf("Error: Bad trace line: %s", err.Error())
+		}
+		switch event.Event {
+		case "puzzle":
+			var err error
+			if paper, err = Parse(event.Width, event.Height, event.Lines); err != nil {
+				return nil, nil, err
+			}
+		case "accept", "undo":
+			if paper == nil {
+				return nil, nil, fmt.Errorf("Error: Trace step %d comes before any puzzle", event.Step)
+			}
+			for _, dir := range DIRS {
+				if dirName(dir) == event.Option {
+					if event.Event == "accept" {
+						paper.connect(event.Pos, dir)
+					} else {
+						paper.disconnect(event.Pos, dir)
+					}
+				}
+			}
+		}
+		if event.Step == step {
+			return paper, event, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if paper == nil || step != 0 {
+		return nil, nil, fmt.Errorf("Error: Trace has no step %d", step)
+	}
+	return paper, event, nil
+}
+
+// Describe the event in a line of text
+func (event *TraceEvent) String() string {
+	switch event.Event {
+	case "puzzle":
+		return fmt.Sprintf("Step %d: puzzle of size %dx%d", event.Step, event.Width, event.Height)
+	case "solved":
+		return fmt.Sprintf("Step %d: solved", event.Step)
+	case "reject":
+		return fmt.Sprintf("Step %d: reject %s at (%d,%d) by %s, depth %d", event.Step, event.Option, event.X, event.Y, event.Reason, event.Depth)
+	}
+	return fmt.Sprintf("Step %d: %s %s at (%d,%d), depth %d", event.Step, event.Event, event.Option, event.X, event.Y, event.Depth)
+}
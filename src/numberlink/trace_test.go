@@ -0,0 +1,55 @@
+package main
+
+import "bytes"
+import "testing"
+
+func TestReplayTrace(t *testing.T) {
+	lines := []string{
+		"C...B",
+		"A.BA.",
+		"...C.",
+		".....",
+	}
+	var buf bytes.Buffer
+	tracer := NewTracer(&buf)
+	p1, _ := Parse(5, 4, lines)
+	tracer.Start(p1)
+	if !Solve(p1) {
+		t.Fatal("Expected the puzzle to be solvable")
+	}
+	if err := tracer.Flush(); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// Replaying the whole trace gives the solution
+	p2, event, err := ReplayTrace(bytes.NewReader(buf.Bytes()), 0)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if event.Event != "solved" {
+		t.Errorf("Expected the last event to be 'solved', got '%s'", event.Event)
+	}
+	for pos := range p1.cells {
+		if p1.Con(pos) != p2.Con(pos) {
+			t.Fatalf("Replayed board differs from the solution at %d", pos)
+		}
+	}
+
+	// After the first step the board is still empty
+	p3, event, err := ReplayTrace(bytes.NewReader(buf.Bytes()), 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if event.Event != "puzzle" {
+		t.Errorf("Expected the first event to be 'puzzle', got '%s'", event.Event)
+	}
+	for pos := range p3.cells {
+		if p3.Con(pos) != 0 {
+			t.Fatalf("Expected an empty board at step 1")
+		}
+	}
+
+	if _, _, err := ReplayTrace(bytes.NewReader(buf.Bytes()), event.Step+1000); err == nil {
+		t.Error("Expected an error replaying to a step past the end")
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import "bufio"
+import "io"
+import "strconv"
+import "strings"
+
+// Reads a grid in the format of PrintTubes, which is all the lines up to the
+// next empty line. Leading empty lines are skipped. Returns io.EOF if there
+// are no more grids.
+func ReadTubes(reader *bufio.Reader) ([]string, error) {
+	return readTubes(reader, make([]string, 0))
+}
+
+// Like ReadTubes, but continuing a grid of which some lines have been read
+func readTubes(reader *bufio.Reader, lines []string) ([]string, error) {
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			lines = append(lines, line)
+		} else if len(lines) != 0 {
+			return lines, nil
+		}
+		if err != nil {
+			if err == io.EOF && len(lines) != 0 {
+				return lines, nil
+			}
+			return nil, err
+		}
+	}
+}
+
+// Parse a grid in the format of PrintTubes back into a paper. Letters are
+// sources, # are holes, ┼ are bridges, and the other box drawing characters
+// give the connections. Bridges are connected to the tubes leading into them. Lines may
+// have lost their trailing spaces, as these only stand for empty squares.
+func ParseTubes(lines []string) (*Paper, error) {
+	return parseTubes(lines, FLAT)
+}
+
+// Like ParseTubes, for a paper with the edges in wrap joined. The margins that
+// PrintTubes draws along the joined edges must match the tubes crossing them.
+func parseTubes(lines []string, wrap int) (*Paper, error) {
+	// The line of the first row of squares, after the margin above it
+	first := 1
+	var north, south string
+	if wrap&N != 0 {
+		if len(lines) < 2 {
+			return nil, &ParseError{0, "missing the margins of the joined edges"}
+		}
+		north, south = lines[0], lines[len(lines)-1]
+		lines = lines[1 : len(lines)-1]
+		first = 2
+	}
+	rows := make([][]rune, len(lines))
+	west, east := make([]rune, len(lines)), make([]rune, len(lines))
+	for y, line := range lines {
+		rows[y] = []rune(line)
+		if wrap&W == 0 {
+			continue
+		}
+		// A row has a mark on the east side only if its flow crosses
+		// the edge, as the west mark says, and trailing spaces may be
+		// lost
+		west[y], east[y] = ' ', ' '
+		if len(rows[y]) > 0 {
+			west[y], rows[y] = rows[y][0], []rune(strings.TrimRight(string(rows[y][1:]), " "))
+		}
+		if n := len(rows[y]); west[y] != ' ' && n > 0 {
+			east[y], rows[y] = rows[y][n-1], rows[y][:n-1]
+		}
+	}
+	width, height := 0, len(rows)
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	if width*height == 0 {
+		return nil, &ParseError{0, "width and height cannot be 0"}
+	}
+
+	tube := make(map[rune]int)
+	for con, c := range TUBE {
+		tube[c] = con
+	}
+	table := make([]rune, 0, width*height)
+	cons := make([]int, 0, width*height)
+	for _, row := range rows {
+		for x := 0; x < width; x++ {
+			c := ' '
+			if x < len(row) {
+				c = row[x]
+			}
+			if con, found := tube[c]; found && c != BRIDGE {
+				table = append(table, EMPTY)
+				cons = append(cons, con)
+			} else if c == EMPTY {
+				return nil, &ParseError{len(table)/width + first, "unexpected '" + string(c) + "'"}
+			} else {
+				table = append(table, c)
+				cons = append(cons, 0)
+			}
+		}
+	}
+	paper := NewPaper(width, height, table)
+	if err := paper.SetWrap(wrap); err != nil {
+		return nil, err
+	}
+
+	// Connect the tubes, and check that their neighbours connect back
+	for i, con := range cons {
+		pos := (i/width+1)*paper.Width + i%width + 1
+		for _, dir := range DIRS {
+			if con&dir == 0 {
+				continue
+			}
+			next := paper.neighbour(pos, dir)
+			if paper.Table[next] == GRASS {
+				return nil, tubeError(i, width, first, "tube leads off the paper")
+			}
+			j := (next/paper.Width-1)*width + next%paper.Width - 1
+			if !paper.isSource(next) && paper.Table[next] != BRIDGE && cons[j]&MIR[dir] == 0 {
+				return nil, tubeError(i, width, first, "tube isn't connected back")
+			}
+			paper.cells[pos].con |= uint8(dir)
+			paper.cells[next].con |= uint8(MIR[dir])
+		}
+	}
+	// Sources next to a source of the same label are connected directly,
+	// since any other way around would make the flow touch itself
+	for pos := range paper.cells {
+		if !paper.isSource(pos) {
+			continue
+		}
+		for _, dir := range []int{E, S} {
+			if next := paper.neighbour(pos, dir); paper.Table[next] == paper.Table[pos] {
+				paper.connect(pos, dir)
+			}
+		}
+	}
+	// Flows go straight over bridges, so a bridge connected on one side is
+	// connected on the other too. Sources have no tubes to say so, and
+	// sources of the same label facing each other across bridges are
+	// connected through them, like those next to each other.
+	for changed := true; changed; {
+		changed = false
+		for pos := range paper.cells {
+			if paper.Table[pos] != BRIDGE {
+				continue
+			}
+			for _, dir := range []int{E, S} {
+				axis := dir | MIR[dir]
+				con := paper.Con(pos) & axis
+				a, b := paper.across(pos, dir), paper.across(pos, MIR[dir])
+				if con == axis || paper.Table[a] == GRASS || paper.Table[b] == GRASS {
+					continue
+				}
+				if con != 0 || paper.isSource(a) && paper.isSource(b) && paper.Table[a] == paper.Table[b] {
+					paper.connect(pos, dir)
+					paper.connect(pos, MIR[dir])
+					changed = true
+				}
+			}
+		}
+	}
+	if err := checkMargins(paper, north, south, west, east, first); err != nil {
+		return nil, err
+	}
+	return paper, nil
+}
+
+// Check the margins along the joined edges of a wrapped paper against the
+// tubes of the squares next to them. The marks of the west and east margins
+// are given by row.
+func checkMargins(paper *Paper, north, south string, west, east []rune, first int) error {
+	w, h := paper.Width, paper.Height
+	colors := makeColorTable(paper, true)
+	edge := func(y, dir int) string {
+		line := ""
+		if paper.Wrap&W != 0 {
+			line = " "
+		}
+		for x := 1; x < w-1; x++ {
+			line += edgeMark(paper, y*w+x, dir, colors)
+		}
+		return strings.TrimRight(line, " ")
+	}
+	if paper.Wrap&N != 0 && strings.TrimRight(north, " ") != edge(1, N) {
+		return &ParseError{1, "margin doesn't match the tubes"}
+	}
+	if paper.Wrap&S != 0 && strings.TrimRight(south, " ") != edge(h-2, S) {
+		return &ParseError{first + h - 2, "margin doesn't match the tubes"}
+	}
+	for y := 1; y < h-1 && paper.Wrap&W != 0; y++ {
+		if string(west[y-1]) != edgeMark(paper, y*w+1, W, colors) || string(east[y-1]) != edgeMark(paper, y*w+w-2, E, colors) {
+			return &ParseError{first + y - 1, "margin doesn't match the tubes"}
+		}
+	}
+	return nil
+}
+
+func tubeError(i, width, first int, problem string) error {
+	return &ParseError{i/width + first, problem + " at column " + strconv.Itoa(i%width)}
+}
+
+// The flows on the paper in the format of PrintSimple, without the size line.
+// Squares not reached from a source are left empty.
+func (paper *Paper) Letters() []string {
+	table := fillTable(paper)
+	lines := make([]string, 0, paper.Height-2)
+	for y := 1; y < paper.Height-1; y++ {
+		lines = append(lines, string(table[y*paper.Width+1:(y+1)*paper.Width-1]))
+	}
+	return lines
+}
+
+// Reads a solution of the given height, in the format of either PrintSimple,
+// including the 'width height' line, or PrintTubes. If height is 0, a tubes
+// solution is read up to the next empty line. The solution is returned in the
+// format of PrintSimple. Tubes of a paper with the edges in wrap joined have
+// margins along those edges.
+func ReadSolution(reader *bufio.Reader, height int, wrap int) ([]string, error) {
+	var first string
+	for first == "" {
+		line, err := reader.ReadString('\n')
+		first = strings.TrimRight(line, "\r\n")
+		if err != nil && (err != io.EOF || first == "") {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+	trim := func(line string) string { return strings.TrimRight(line, "\r\n") }
+	if parts := strings.Split(strings.TrimSpace(first), " "); len(parts) == 2 {
+		_, err1 := strconv.Atoi(parts[0])
+		h, err2 := strconv.Atoi(parts[1])
+		if err1 == nil && err2 == nil {
+			return readLines(reader, make([]string, 0, h), h, strings.TrimSpace)
+		}
+	}
+	var lines []string
+	var err error
+	if height == 0 {
+		lines, err = readTubes(reader, []string{first})
+	} else if wrap&N != 0 {
+		lines, err = readLines(reader, []string{first}, height+2, trim)
+	} else {
+		lines, err = readLines(reader, []string{first}, height, trim)
+	}
+	if err != nil {
+		return nil, err
+	}
+	paper, err := parseTubes(lines, wrap)
+	if err != nil {
+		return nil, err
+	}
+	return paper.Letters(), nil
+}
+
+// Append lines from the reader until there are n
+func readLines(reader *bufio.Reader, lines []string, n int, trim func(string) string) ([]string, error) {
+	for len(lines) < n {
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		lines = append(lines, trim(line))
+	}
+	return lines, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import "bufio"
+import "strings"
+import "testing"
+
+func TestParseTubes(t *testing.T) {
+	lines := []string{
+		"C┐┌─B",
+		"A│BA┐",
+		"│└─C│",
+		"└───┘",
+	}
+	p, err := ParseTubes(lines)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []string{
+		"CCBBB",
+		"ACBAA",
+		"ACCCA",
+		"AAAAA",
+	}
+	if letters := p.Letters(); strings.Join(letters, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %v, got %v", expected, letters)
+	}
+
+	// The same paper comes out of the solver
+	q, _ := Parse(5, 4, []string{
+		"C...B",
+		"A.BA.",
+		"...C.",
+		".....",
+	})
+	Solve(q)
+	for pos := range q.cells {
+		if p.Con(pos) != q.Con(pos) || p.Table[pos] != q.Table[pos] {
+			t.Fatalf("Parsed paper differs from the solved one at %d", pos)
+		}
+	}
+
+	// Adjacent sources, and a line that lost its trailing space
+	p, err = ParseTubes([]string{"aa┌b", "b─┘"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if letters := strings.Join(p.Letters(), "\n"); letters != "aabb\nbbb." {
+		t.Errorf("Unexpected letters %q", letters)
+	}
+
+	// Sources next to a bridge have no tube into it
+	p, err = ParseTubes([]string{"a┐b", "┌┼┘", "b└a"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if letters := strings.Join(p.Letters(), "\n"); letters != "aab\nb┼b\nbaa" {
+		t.Errorf("Unexpected letters %q", letters)
+	}
+
+	if _, err := ParseTubes([]string{"a─b", "a─┐"}); err == nil {
+		t.Error("Expected an error for a tube leading off the paper")
+	}
+	if _, err := ParseTubes([]string{"a┐b", "a b"}); err == nil {
+		t.Error("Expected an error for a tube not connected back")
+	}
+}
+
+func TestReadSolution(t *testing.T) {
+	input := "4 2\naabb\nbbbb\n\naa┌b\nb─┘b\nnext"
+	reader := bufio.NewReader(strings.NewReader(input))
+	for i := 0; i < 2; i++ {
+		lines, err := ReadSolution(reader, 2, FLAT)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if strings.Join(lines, "\n") != "aabb\nbbbb" {
+			t.Errorf("Unexpected solution %q", lines)
+		}
+	}
+	if rest, _ := reader.ReadString('\n'); rest != "next" {
+		t.Errorf("Read too far, left '%s'", rest)
+	}
+}
+
+func TestReadSolutionUntilEmptyLine(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("aa┌b\nb─┘b\n\nnext"))
+	lines, err := ReadSolution(reader, 0, FLAT)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if strings.Join(lines, "\n") != "aabb\nbbbb" {
+		t.Errorf("Unexpected solution %q", lines)
+	}
+	if rest, _ := reader.ReadString('\n'); rest != "next" {
+		t.Errorf("Read too far, left '%s'", rest)
+	}
+}
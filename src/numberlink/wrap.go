@@ -0,0 +1,192 @@
+package main
+
+import "fmt"
+import "math/bits"
+
+// The edges of a paper which are joined to the opposite edge, so flows can
+// leave by one and come back by the other
+const (
+	FLAT     = 0
+	CYLINDER = E | W
+	TORUS    = N | E | S | W
+)
+
+var TOPOLOGIES = map[string]int{
+	"flat":     FLAT,
+	"cylinder": CYLINDER,
+	"torus":    TORUS,
+}
+
+// Join the edges in wrap of the paper. Each joined pair of edges must be at
+// least 3 squares apart, or a square would have the same neighbour on both
+// sides. The rules of the sweep about corners don't hold across the joined
+// edges, so on wrapped papers every square is marked NEAR, like those next to
+// bridges.
+func (paper *Paper) SetWrap(wrap int) error {
+	if wrap&E != 0 && paper.Width-2 < 3 || wrap&S != 0 && paper.Height-2 < 3 {
+		return fmt.Errorf("Error: A paper must be at least 3 squares across to wrap around")
+	}
+	if wrap != FLAT && paper.bridges() {
+		return fmt.Errorf("Error: Bridges are not supported on wrapped papers")
+	}
+	paper.Wrap = wrap
+	if wrap != FLAT {
+		for pos := range paper.cells {
+			if paper.Table[pos] != GRASS {
+				paper.cells[pos].flag |= NEAR
+			}
+		}
+	}
+	return nil
+}
+
+// The square next to pos in direction dir. Across a joined edge, that is the
+// square on the opposite side of the paper.
+func (paper *Paper) neighbour(pos int, dir int) int {
+	next := pos + paper.Vctr[dir]
+	if paper.Wrap&dir == 0 {
+		return next
+	}
+	w, h := paper.Width, paper.Height
+	switch {
+	case next%w == 0:
+		next += w - 2
+	case next%w == w-1:
+		next -= w - 2
+	case next < w:
+		next += (h - 2) * w
+	case next >= (h-1)*w:
+		next -= (h - 2) * w
+	}
+	return next
+}
+
+// The directions in which the sweep connects pos, which are those of the
+// neighbours it visits after pos. Besides E and S, these are W and N on the
+// first column and row, if they are joined to the last.
+func (paper *Paper) ahead(pos int) int {
+	w, h := paper.Width, paper.Height
+	dirs := 0
+	if pos%w < w-2 {
+		dirs |= E
+	}
+	if pos/w < h-2 {
+		dirs |= S
+	}
+	if pos%w == 1 {
+		dirs |= paper.Wrap & W
+	}
+	if pos/w == 1 {
+		dirs |= paper.Wrap & N
+	}
+	for _, dir := range DIRS {
+		if dirs&dir != 0 && paper.cells[paper.neighbour(pos, dir)].flag&BLOCKED != 0 {
+			dirs &^= dir
+		}
+	}
+	return dirs
+}
+
+// Check if the square at pos has all the connections it can take
+func (paper *Paper) full(pos int) bool {
+	c := &paper.cells[pos]
+	n := bits.OnesCount8(c.con)
+	return n == 2 || n == 1 && c.flag&SOURCE != 0
+}
+
+// Like chooseConnection, for wrapped papers. Flows may come back to a square
+// from across a joined edge, so it tries every way to make the connections it
+// still needs towards the squares ahead of it.
+func chooseAround(paper *Paper, pos int) bool {
+	here := &paper.cells[pos]
+	need := 2
+	if here.flag&SOURCE != 0 {
+		need = 1
+	}
+	need -= bits.OnesCount8(here.con)
+	ahead := paper.ahead(pos)
+	if need < 0 || need > bits.OnesCount(uint(ahead)) {
+		return paper.pruned(PRUNE_DEGREE, pos, 0)
+	}
+	if need == 0 {
+		if here.con&here.fixed != here.fixed {
+			return paper.pruned(PRUNE_FIXED, pos, 0)
+		}
+		if paper.touchesAround(pos) {
+			return paper.pruned(PRUNE_TOUCHING, pos, 0)
+		}
+		return chooseConnection(paper, int(here.next))
+	}
+	branch := uint8(0)
+	for dirs := ahead; dirs != 0; dirs = (dirs - 1) & ahead {
+		if bits.OnesCount(uint(dirs)) != need {
+			continue
+		}
+		if tryBranch(paper, pos, branch, dirs) {
+			return true
+		}
+		branch++
+	}
+	return false
+}
+
+// Check if the completed flow from the source at pos runs next to itself
+// anywhere it isn't connected. On flat papers the corner rules keep flows
+// from doing so, and validate catches the rest once the paper is full, but
+// on wrapped papers each flow is checked as soon as it is completed.
+func (paper *Paper) touchesItself(pos int) bool {
+	vtable := paper.vtable
+	for p, old := pos, -1; p != -1; p, old = paper.step(p, old), p {
+		vtable[p] = 1
+	}
+	touching := false
+	for p, old := pos, -1; p != -1; p, old = paper.step(p, old), p {
+		for _, dir := range DIRS {
+			if paper.Con(p)&dir == 0 && vtable[paper.neighbour(p, dir)] == 1 {
+				touching = true
+			}
+		}
+	}
+	for p, old := pos, -1; p != -1; p, old = paper.step(p, old), p {
+		vtable[p] = 0
+	}
+	return touching
+}
+
+// The square after p on its flow, when coming from old, or -1 at the end
+func (paper *Paper) step(p, old int) int {
+	for _, dir := range DIRS {
+		if next := paper.neighbour(p, dir); paper.Con(p)&dir != 0 && next != old {
+			return next
+		}
+	}
+	return -1
+}
+
+// Check if the square at pos, which has all its connections, is next to its
+// own flow anywhere it isn't connected. Squares are on the same flow if they
+// are on the same link, or on links of the same colour.
+func (paper *Paper) touchesAround(pos int) bool {
+	end := paper.linkEnd(pos)
+	label := paper.cells[end].label
+	for _, dir := range DIRS {
+		next := paper.neighbour(pos, dir)
+		if paper.Con(pos)&dir != 0 || paper.cells[next].flag&BLOCKED != 0 {
+			continue
+		}
+		other := paper.linkEnd(next)
+		if other == end || other == int(paper.cells[end].end) || label != EMPTY && paper.cells[other].label == label {
+			return true
+		}
+	}
+	return false
+}
+
+// One of the ends of the link through pos
+func (paper *Paper) linkEnd(pos int) int {
+	old := -1
+	for next := paper.step(pos, old); next != -1; next = paper.step(pos, old) {
+		old, pos = pos, next
+	}
+	return pos
+}
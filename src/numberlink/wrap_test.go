@@ -0,0 +1,108 @@
+package main
+
+import "bufio"
+import "strings"
+import "testing"
+
+var wraptests = []struct {
+	wrap          int
+	width, height int
+	lines         []string
+}{
+	{CYLINDER, 3, 3, []string{"b.a", "...", "a.b"}},
+	{CYLINDER, 4, 3, []string{"abac", "...c", ".b.."}},
+	{TORUS, 3, 3, []string{".c.", "b.c", "aab"}},
+	{TORUS, 3, 4, []string{"...", "...", "ab.", ".ab"}},
+}
+
+// Each puzzle is impossible on a flat paper, but can be solved by crossing the
+// joined edges
+func TestWrap(t *testing.T) {
+	for name, solve := range backends {
+		for _, tt := range wraptests {
+			p, _ := Parse(tt.width, tt.height, tt.lines)
+			if solve(p) {
+				t.Errorf("%s: Expected %v to be impossible on a flat paper", name, tt.lines)
+			}
+			p, _ = Parse(tt.width, tt.height, tt.lines)
+			if err := p.SetWrap(tt.wrap); err != nil {
+				t.Fatal(err.Error())
+			}
+			if problems := Analyze(p); len(problems) != 0 {
+				t.Errorf("Unexpected problems %v for %v", problems, tt.lines)
+			}
+			if !solve(p) {
+				t.Errorf("%s: Expected a solution for %v", name, tt.lines)
+				continue
+			}
+			if err := Check(p, p.Letters()); err != nil {
+				t.Errorf("%s: Bad solution %v for %v: %s", name, p.Letters(), tt.lines, err.Error())
+			}
+		}
+	}
+}
+
+func TestCheckWrap(t *testing.T) {
+	puzzle := []string{"b.a", "...", "a.b"}
+	solution := []string{"bba", "aba", "abb"}
+	p, _ := Parse(3, 3, puzzle)
+	if err := Check(p, solution); err == nil {
+		t.Error("Expected the solution to be wrong on a flat paper")
+	}
+	p.SetWrap(CYLINDER)
+	if err := Check(p, solution); err != nil {
+		t.Error(err.Error())
+	}
+	p.SetWrap(TORUS)
+	if err := Check(p, solution); err == nil {
+		t.Error("Expected flows touching across the top and bottom edges on a torus")
+	}
+}
+
+func TestSetWrap(t *testing.T) {
+	p, _ := Parse(2, 3, []string{"ab", "..", "ab"})
+	if err := p.SetWrap(CYLINDER); err == nil {
+		t.Error("Expected an error for a cylinder 2 squares around")
+	}
+	if err := p.SetWrap(N | S); err != nil {
+		t.Error(err.Error())
+	}
+	if next := p.neighbour(p.Width+1, N); next != 3*p.Width+1 {
+		t.Errorf("Expected the top left square to be below the bottom left, got %d", next)
+	}
+	if next := p.neighbour(p.Width+1, W); next != p.Width {
+		t.Errorf("Expected the grass left of the top left square, got %d", next)
+	}
+}
+
+// The tubes of wrapped papers, as PrintTubes draws them, read back with their
+// margins
+func TestReadWrappedSolution(t *testing.T) {
+	solutions := []struct {
+		wrap    int
+		input   string
+		letters string
+	}{
+		{CYLINDER, " b┌a\n─┘│┌─\n a┘b\n", "baa\nbab\naab"},
+		{TORUS, "   │\n─┐c└─\n b└c \n aab \n   │\n", "bcb\nbcc\naab"},
+		// The margins must match the tubes crossing the edges
+		{CYLINDER, " b┌a\n ┘│┌─\n a┘b\n", ""},
+		{TORUS, "  │\n─┐c└─\n b└c\n aab\n   │\n", ""},
+	}
+	for _, s := range solutions {
+		lines, err := ReadSolution(bufio.NewReader(strings.NewReader(s.input)), 3, s.wrap)
+		if s.letters == "" {
+			if err == nil {
+				t.Errorf("Expected an error for the margins of %q", s.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %s", s.input, err.Error())
+			continue
+		}
+		if strings.Join(lines, "\n") != s.letters {
+			t.Errorf("Expected %q, got %q", s.letters, lines)
+		}
+	}
+}